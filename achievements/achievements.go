@@ -0,0 +1,220 @@
+package achievements
+
+import (
+	"bitbucket.org/jahfer/flux-middleman/helper"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Who a rule is counted for, and who gets the badge
+const (
+	UserScope = "user"
+	TeamScope = "team"
+)
+
+// A single badge, as written in the rules file:
+//
+//	{"badge": "triggerHappy", "event": "user:shoot", "threshold": 3, "window": "5s", "scope": "user"}
+type Rule struct {
+	Badge string `json:"badge"`
+	// event that moves the counter
+	Event string `json:"event"`
+	// value carried by the event to compare; counts occurrences when empty
+	Counter   string `json:"counter"`
+	Threshold int    `json:"threshold"`
+	// only occurrences this recent are counted, e.g. "5s"; forever when empty
+	Window string `json:"window"`
+	Scope  string `json:"scope"`
+	// event that starts the count over
+	Reset string `json:"reset"`
+
+	window time.Duration
+}
+
+// Something that happened in a game that a badge might care about
+type Event struct {
+	Name   string
+	UserId int
+	TeamId int
+	// everyone on the team, for team scoped rules
+	Members []int
+	Values  map[string]int
+}
+
+type Engine struct {
+	mutex sync.Mutex
+	rules []Rule
+	hits  map[string][]time.Time
+	// hands out the badge, helper.SendBadge unless testing
+	Award func(s helper.Scope, badge string, userId int)
+}
+
+// Engine every package reports to
+var Default = New(nil)
+
+func New(rules []Rule) *Engine {
+	return &Engine{
+		rules: rules,
+		hits:  make(map[string][]time.Time),
+		Award: helper.SendBadge,
+	}
+}
+
+// Read rules from a JSON file holding a list of Rule
+func Load(path string) (*Engine, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []Rule
+	if err := json.NewDecoder(f).Decode(&rules); err != nil {
+		return nil, err
+	}
+
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return nil, err
+		}
+	}
+
+	return New(rules), nil
+}
+
+func (r *Rule) compile() (err error) {
+	if r.Badge == "" || r.Event == "" {
+		return errors.New("Badge rule needs a badge and an event")
+	}
+
+	switch r.Scope {
+	case "":
+		r.Scope = UserScope
+	case UserScope, TeamScope:
+	default:
+		return fmt.Errorf("Unknown scope %q for badge %v", r.Scope, r.Badge)
+	}
+
+	if r.Threshold < 1 {
+		r.Threshold = 1
+	}
+
+	if r.Window != "" {
+		r.window, err = time.ParseDuration(r.Window)
+	}
+
+	return
+}
+
+// Report an event to the default engine
+func Emit(s helper.Scope, evt Event) {
+	Default.Emit(s, evt)
+}
+
+// Run the event past every rule, awarding any badge it completes
+func (e *Engine) Emit(s helper.Scope, evt Event) {
+	type award struct {
+		badge  string
+		userId int
+	}
+	var awards []award
+
+	e.mutex.Lock()
+
+	now := time.Now()
+
+	for _, rule := range e.rules {
+		key := e.key(s, rule, evt)
+
+		if rule.Reset == evt.Name {
+			delete(e.hits, key)
+		}
+
+		if rule.Event != evt.Name {
+			continue
+		}
+
+		var measure int
+
+		if rule.Counter == "" {
+			hits := append(e.hits[key], now)
+			if rule.window > 0 {
+				hits = trim(hits, now.Add(-rule.window))
+			}
+			// anything past the threshold changes nothing
+			if len(hits) > rule.Threshold {
+				hits = append([]time.Time(nil), hits[len(hits)-rule.Threshold:]...)
+			}
+			e.hits[key] = hits
+			measure = len(hits)
+		} else {
+			measure = evt.Values[rule.Counter]
+		}
+
+		if measure < rule.Threshold {
+			continue
+		}
+
+		if rule.Scope == TeamScope {
+			for _, userId := range evt.Members {
+				awards = append(awards, award{rule.Badge, userId})
+			}
+		} else {
+			awards = append(awards, award{rule.Badge, evt.UserId})
+		}
+	}
+
+	e.mutex.Unlock()
+
+	for _, a := range awards {
+		e.Award(s, a.badge, a.userId)
+	}
+}
+
+// Drop every count kept for the room, once it has closed
+func (e *Engine) ForgetRoom(s helper.Scope) {
+	e.forget(s.Keys.Namespace())
+}
+
+// Drop the player's counts, once they've left
+func (e *Engine) ForgetUser(s helper.Scope, userId int) {
+	e.forget(fmt.Sprintf("%v%v:%v:", s.Keys.Namespace(), UserScope, userId))
+}
+
+// Drop the team's counts, once it's gone
+func (e *Engine) ForgetTeam(s helper.Scope, teamId int) {
+	e.forget(fmt.Sprintf("%v%v:%v:", s.Keys.Namespace(), TeamScope, teamId))
+}
+
+func (e *Engine) forget(prefix string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for key := range e.hits {
+		if strings.HasPrefix(key, prefix) {
+			delete(e.hits, key)
+		}
+	}
+}
+
+func (e *Engine) key(s helper.Scope, rule Rule, evt Event) string {
+	id := evt.UserId
+	if rule.Scope == TeamScope {
+		id = evt.TeamId
+	}
+	return fmt.Sprintf("%v%v:%v:%v", s.Keys.Namespace(), rule.Scope, id, rule.Badge)
+}
+
+// Drop hits older than the cutoff
+func trim(hits []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(hits) && hits[i].Before(cutoff) {
+		i++
+	}
+	return hits[i:]
+}
@@ -0,0 +1,131 @@
+package achievements
+
+import (
+	"bitbucket.org/jahfer/flux-middleman/helper"
+	"testing"
+	"time"
+)
+
+func testEngine(t *testing.T, rules []Rule) (*Engine, *[]string) {
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var awarded []string
+	e := New(rules)
+	e.Award = func(s helper.Scope, badge string, userId int) {
+		awarded = append(awarded, badge)
+	}
+
+	return e, &awarded
+}
+
+func TestStreakResets(t *testing.T) {
+	e, awarded := testEngine(t, []Rule{
+		{Badge: "bumperCrop", Event: "collector:complete", Threshold: 3, Reset: "collector:incomplete"},
+	})
+	s := helper.Scope{}
+
+	e.Emit(s, Event{Name: "collector:complete", UserId: 1})
+	e.Emit(s, Event{Name: "collector:complete", UserId: 1})
+	e.Emit(s, Event{Name: "collector:incomplete", UserId: 1})
+	e.Emit(s, Event{Name: "collector:complete", UserId: 1})
+
+	if len(*awarded) != 0 {
+		t.Errorf("Badge awarded despite reset: %v", *awarded)
+	}
+
+	e.Emit(s, Event{Name: "collector:complete", UserId: 1})
+	e.Emit(s, Event{Name: "collector:complete", UserId: 1})
+
+	if len(*awarded) != 1 {
+		t.Errorf("Expected one badge, got %v", *awarded)
+	}
+}
+
+func TestWindowForgetsOldHits(t *testing.T) {
+	e, awarded := testEngine(t, []Rule{
+		{Badge: "triggerHappy", Event: "user:shoot", Threshold: 2, Window: "20ms"},
+	})
+	s := helper.Scope{}
+
+	e.Emit(s, Event{Name: "user:shoot", UserId: 1})
+	time.Sleep(30 * time.Millisecond)
+	e.Emit(s, Event{Name: "user:shoot", UserId: 1})
+
+	if len(*awarded) != 0 {
+		t.Errorf("Old shot still counted: %v", *awarded)
+	}
+
+	e.Emit(s, Event{Name: "user:shoot", UserId: 1})
+
+	if len(*awarded) != 1 {
+		t.Errorf("Expected one badge, got %v", *awarded)
+	}
+}
+
+func TestTeamScopeAwardsEveryMember(t *testing.T) {
+	e, awarded := testEngine(t, []Rule{
+		{Badge: "theOcho", Event: "team:size", Counter: "size", Threshold: 8, Scope: TeamScope},
+	})
+	s := helper.Scope{}
+
+	e.Emit(s, Event{Name: "team:size", TeamId: 2, Members: []int{1, 2}, Values: map[string]int{"size": 2}})
+	e.Emit(s, Event{Name: "team:size", TeamId: 2, Members: []int{1, 2, 3}, Values: map[string]int{"size": 8}})
+
+	if len(*awarded) != 3 {
+		t.Errorf("Expected badge for all 3 members, got %v", *awarded)
+	}
+}
+
+func TestLoadShippedRules(t *testing.T) {
+	if _, err := Load("../badges.json"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestForgetRoom(t *testing.T) {
+	e, awarded := testEngine(t, []Rule{
+		{Badge: "bumperCrop", Event: "collector:complete", Threshold: 2},
+	})
+	closing := helper.NewScope("ABCD")
+	open := helper.NewScope("WXYZ")
+
+	e.Emit(closing, Event{Name: "collector:complete", UserId: 1})
+	e.Emit(open, Event{Name: "collector:complete", UserId: 1})
+	e.ForgetRoom(closing)
+
+	e.Emit(closing, Event{Name: "collector:complete", UserId: 1})
+	if len(*awarded) != 0 {
+		t.Errorf("Count survived the room closing: %v", *awarded)
+	}
+
+	e.Emit(open, Event{Name: "collector:complete", UserId: 1})
+	if len(*awarded) != 1 {
+		t.Errorf("Another room's count was forgotten: %v", *awarded)
+	}
+}
+
+func TestCountsStayBounded(t *testing.T) {
+	e, _ := testEngine(t, []Rule{
+		{Badge: "bumperCrop", Event: "collector:complete", Threshold: 3},
+	})
+	s := helper.NewScope("ABCD")
+
+	for i := 0; i < 100; i++ {
+		e.Emit(s, Event{Name: "collector:complete", UserId: 1})
+		e.Emit(s, Event{Name: "collector:complete", UserId: 12})
+	}
+	for key, hits := range e.hits {
+		if len(hits) > 3 {
+			t.Errorf("Kept %v hits for %v", len(hits), key)
+		}
+	}
+
+	e.ForgetUser(s, 1)
+	if len(e.hits) != 1 {
+		t.Errorf("Expected only user 12's count to survive, got %v", e.hits)
+	}
+}
@@ -0,0 +1,92 @@
+package badges
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Everything the phone needs to show a badge
+type Badge struct {
+	Id          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Icon        string `json:"icon"`
+	Rarity      string `json:"rarity"`
+	// not listed until somebody earns it
+	Hidden bool `json:"hidden"`
+}
+
+// A badge as one player has it
+type Earned struct {
+	Badge
+	// unix time it was awarded
+	Earned int64 `json:"earned"`
+}
+
+var (
+	mutex   sync.RWMutex
+	catalog = make(map[string]Badge)
+)
+
+// Read the catalog from a JSON file holding a list of Badge
+func Load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var list []Badge
+	if err := json.NewDecoder(f).Decode(&list); err != nil {
+		return err
+	}
+
+	Set(list)
+	return nil
+}
+
+// Replace the catalog
+func Set(list []Badge) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	catalog = make(map[string]Badge)
+	for _, b := range list {
+		catalog[b.Id] = b
+	}
+}
+
+// Look up a badge, falling back to its bare id when it isn't catalogued
+func Get(id string) (Badge, bool) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	b, ok := catalog[id]
+	if !ok {
+		b = Badge{Id: id, Title: id}
+	}
+	return b, ok
+}
+
+type byId []Badge
+
+func (s byId) Len() int           { return len(s) }
+func (s byId) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byId) Less(i, j int) bool { return s[i].Id < s[j].Id }
+
+// Every badge that can be shown to players
+func Visible() (list []Badge) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	for _, b := range catalog {
+		if !b.Hidden {
+			list = append(list, b)
+		}
+	}
+
+	sort.Sort(byId(list))
+	return
+}
@@ -0,0 +1,30 @@
+package badges
+
+import (
+	"testing"
+)
+
+func TestLoadShippedCatalog(t *testing.T) {
+	if err := Load("../catalog.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, ok := Get("theOcho"); !ok || b.Title == "" {
+		t.Errorf("theOcho missing from catalog: %+v", b)
+	}
+
+	for _, b := range Visible() {
+		if b.Hidden {
+			t.Errorf("Hidden badge listed: %v", b.Id)
+		}
+	}
+}
+
+func TestUnknownBadgeFallsBackToId(t *testing.T) {
+	Set(nil)
+
+	b, ok := Get("mystery")
+	if ok || b.Id != "mystery" || b.Title != "mystery" {
+		t.Errorf("Unexpected fallback: %+v", b)
+	}
+}
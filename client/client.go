@@ -130,6 +130,11 @@ func (c *TcpClient) Listener(incoming chan packet.In) {
 	c.Conn.Close()
 }
 
+// Hang up on the client; the listener notices and cleans up
+func (c *TcpClient) Disconnect() error {
+	return c.Conn.Close()
+}
+
 // Oh, you want to send something out? Fiiiiine...
 func (c *TcpClient) Sender() {
 	for message := range c.Send {
@@ -169,6 +174,11 @@ func (c *WebSocketClient) Listener(incoming chan packet.In) {
 	incoming <- deadPacket
 }
 
+// Hang up on the client; the listener notices and cleans up
+func (c *WebSocketClient) Disconnect() error {
+	return c.Conn.Close()
+}
+
 // Dispatch data sent into the connection
 func (c *WebSocketClient) Sender() {
 	for message := range c.Send {
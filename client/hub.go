@@ -4,20 +4,39 @@ import (
 	"fmt"
 )
 
+// Message meant only for the clients inside one room
+type Envelope struct {
+	Room    string
+	Message interface{}
+}
+
+// Message worked out separately for each client, e.g. touches scaled
+// to each display's resolution; nil skips the client
+type Tailored func(c Client) interface{}
+
+// Request to move a client into a room
+type Membership struct {
+	Client Client
+	Room   string
+}
+
 // Manager for incoming/outgoing traffic for a specified group of clients
 type Hub struct {
-	clients    map[Client]bool
+	// client -> room code
+	clients    map[Client]string
 	Broadcast  chan interface{}
 	Register   chan Client
 	Unregister chan Client
+	Join       chan Membership
 }
 
 func NewHub() Hub {
 	return Hub{
-		clients:    make(map[Client]bool),
+		clients:    make(map[Client]string),
 		Broadcast:  make(chan interface{}),
 		Register:   make(chan Client),
 		Unregister: make(chan Client),
+		Join:       make(chan Membership),
 	}
 }
 
@@ -33,7 +52,13 @@ func (h *Hub) Run() {
 		// add new client
 		case c := <-h.Register:
 			fmt.Printf("[NOTICE]\tclient connected\n")
-			h.clients[c] = true
+			h.clients[c] = ""
+
+		// client has picked a room
+		case m := <-h.Join:
+			if _, ok := h.clients[m.Client]; ok {
+				h.clients[m.Client] = m.Room
+			}
 
 		// lost connection with client
 		case c := <-h.Unregister:
@@ -43,10 +68,28 @@ func (h *Hub) Run() {
 
 		// message being piped in to relay to clients
 		case msg := <-h.Broadcast:
-			for c := range h.clients {
-				fmt.Printf("[SENDING]\t%+v\n", msg)
+			room, scoped := "", false
+			if env, ok := msg.(Envelope); ok {
+				room, scoped, msg = env.Room, true, env.Message
+			}
+
+			tailor, tailored := msg.(Tailored)
+
+			for c, r := range h.clients {
+				if scoped && r != room {
+					continue
+				}
+
+				out := msg
+				if tailored {
+					if out = tailor(c); out == nil {
+						continue
+					}
+				}
+
+				fmt.Printf("[SENDING]\t%+v\n", out)
 				// format according to protocol
-				data := c.Format(msg)
+				data := c.Format(out)
 				// send for transmit
 				_, err := c.Write(data)
 				if err != nil {
@@ -0,0 +1,112 @@
+package cluster
+
+import (
+	"bitbucket.org/jahfer/flux-middleman/db"
+	"bitbucket.org/jahfer/flux-middleman/keys"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// How a server takes part in a cluster. Several servers on one machine
+// share a Redis database: the primary runs the game (rooms, teams and
+// rounds, so every team assignment is made in one place) and holds the
+// XNA displays, while edges only hold phone connections. Edges pass
+// everything their phones send to the primary over pub/sub, and the
+// primary sends back replies and broadcasts the same way.
+const (
+	Primary = "primary"
+	Edge    = "edge"
+)
+
+// Primary, Edge, or "" when running on its own
+var Role = ""
+
+func IsRole(role string) bool {
+	return role == "" || role == Primary || role == Edge
+}
+
+// Tells the servers in a cluster apart
+var Id = instanceId()
+
+func instanceId() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%v-%v", host, os.Getpid())
+}
+
+// Kinds of message passed between servers
+const (
+	// edge -> primary: something a phone sent
+	event = "event"
+	// edge -> primary: the phone went away
+	dead = "dead"
+	// primary -> edge: write to one phone
+	reply = "reply"
+	// primary -> edge: move a phone into a hub room
+	join = "join"
+	// primary -> edge: drop a phone
+	drop = "drop"
+	// primary -> edges: write to every phone in a hub room
+	broadcast = "broadcast"
+)
+
+type message struct {
+	Kind string `json:"kind"`
+	From string `json:"from"`
+	Conn int64  `json:"conn,omitempty"`
+	Room string `json:"room,omitempty"`
+	Data []byte `json:"data,omitempty"`
+}
+
+// Channel the primary takes phone events from
+func eventsChannel() string {
+	return keys.Channel("events")
+}
+
+// Channel every edge takes broadcasts from
+func broadcastChannel() string {
+	return keys.Channel("broadcast")
+}
+
+// Channel one server takes its replies from
+func instanceChannel(id string) string {
+	return keys.Channel("to:" + id)
+}
+
+func publish(channel string, m message) error {
+	// phones can connect before the store is up
+	if db.Client == nil {
+		return errors.New("Not connected to the store yet")
+	}
+
+	m.From = Id
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return db.Client.Publish(channel, string(data))
+}
+
+// Decode the messages arriving on the channel and hand them to handle
+func listen(channel string, handle func(m message)) error {
+	msgs, err := db.Client.Subscribe(channel)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for raw := range msgs {
+			var m message
+			if err := json.Unmarshal([]byte(raw), &m); err != nil {
+				fmt.Printf("[NOTICE]\tCaught malformed cluster message: %v\n", raw)
+				continue
+			}
+			handle(m)
+		}
+	}()
+
+	return nil
+}
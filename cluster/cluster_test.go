@@ -0,0 +1,97 @@
+package cluster
+
+import (
+	"bitbucket.org/jahfer/flux-middleman/client"
+	"bitbucket.org/jahfer/flux-middleman/db"
+	"bitbucket.org/jahfer/flux-middleman/packet"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// Phone connection that records what is written to it
+type phone struct {
+	written chan string
+}
+
+func (p *phone) Write(b []byte) (int, error) {
+	p.written <- string(b)
+	return len(b), nil
+}
+func (p *phone) Close() error                { return nil }
+func (p *phone) Format(v interface{}) []byte { data, _ := json.Marshal(v); return data }
+
+func TestEdgeAndPrimary(t *testing.T) {
+	db.Client = db.NewMemory()
+	defer func() { db.Client, Role = nil, "" }()
+
+	incoming := make(chan packet.In)
+	if err := ListenPrimary(incoming); err != nil {
+		t.Fatal(err)
+	}
+
+	hub := client.NewHub()
+	bridge := NewBridge(&hub)
+	if err := bridge.Listen(); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := &phone{written: make(chan string, 1)}
+	bridge.Relay(packet.In{Raw: []byte(`[{"name":"user:new"}]`), Sender: conn})
+
+	var remote *Remote
+	select {
+	case pkt := <-incoming:
+		if string(pkt.Raw) != `[{"name":"user:new"}]` {
+			t.Errorf("Primary got %q", pkt.Raw)
+		}
+		remote = pkt.Sender.(*Remote)
+	case <-time.After(time.Second):
+		t.Fatal("Event never reached the primary")
+	}
+
+	// replies find their way back to the phone
+	remote.Write([]byte("welcome"))
+	select {
+	case got := <-conn.written:
+		if got != "welcome" {
+			t.Errorf("Phone got %q", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Reply never reached the phone")
+	}
+
+	remote.Join("ABCD")
+	select {
+	case m := <-hub.Join:
+		if m.Client != conn || m.Room != "ABCD" {
+			t.Errorf("Got membership %+v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Phone never joined the room on its edge")
+	}
+
+	Role = Primary
+	Broadcast("ABCD", packet.Out{Name: "game:state", Message: "running"})
+	select {
+	case msg := <-hub.Broadcast:
+		env := msg.(client.Envelope)
+		data, _ := json.Marshal(env.Message)
+		if env.Room != "ABCD" || string(data) != `{"name":"game:state","message":"running"}` {
+			t.Errorf("Got broadcast %v %s", env.Room, data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Broadcast never reached the edge")
+	}
+
+	// disconnecting reaches the primary as the same sender
+	bridge.Relay(packet.In{Sender: conn})
+	select {
+	case pkt := <-incoming:
+		if pkt.Raw != nil || pkt.Sender != remote {
+			t.Errorf("Got %+v after the phone left", pkt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Disconnect never reached the primary")
+	}
+}
@@ -0,0 +1,108 @@
+package cluster
+
+import (
+	"bitbucket.org/jahfer/flux-middleman/client"
+	"bitbucket.org/jahfer/flux-middleman/packet"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Connection that can be dropped by the server
+type disconnecter interface {
+	Disconnect() error
+}
+
+// Links the phones connected to an edge with the primary
+type Bridge struct {
+	hub   *client.Hub
+	mutex sync.Mutex
+	// conn id -> phone, and back
+	conns map[int64]io.WriteCloser
+	ids   map[io.WriteCloser]int64
+	next  int64
+}
+
+func NewBridge(hub *client.Hub) *Bridge {
+	return &Bridge{
+		hub:   hub,
+		conns: make(map[int64]io.WriteCloser),
+		ids:   make(map[io.WriteCloser]int64),
+	}
+}
+
+// Send what a phone here sent on to the primary; meant for
+// events.Manager.Relay
+func (b *Bridge) Relay(pkt packet.In) {
+	id := b.idOf(pkt.Sender)
+
+	m := message{Kind: event, Conn: id, Data: pkt.Raw}
+	if pkt.Raw == nil {
+		m.Kind = dead
+		b.forget(pkt.Sender)
+	}
+
+	if err := publish(eventsChannel(), m); err != nil {
+		fmt.Printf("[ERROR]\tCould not pass %v on to the primary. %v\n", m.Kind, err)
+	}
+}
+
+// Start taking replies and broadcasts from the primary
+func (b *Bridge) Listen() error {
+	if err := listen(instanceChannel(Id), b.handle); err != nil {
+		return err
+	}
+	return listen(broadcastChannel(), b.handle)
+}
+
+func (b *Bridge) handle(m message) {
+	if m.Kind == broadcast {
+		// already encoded by the primary
+		b.hub.Broadcast <- client.Envelope{Room: m.Room, Message: json.RawMessage(m.Data)}
+		return
+	}
+
+	b.mutex.Lock()
+	conn, ok := b.conns[m.Conn]
+	b.mutex.Unlock()
+
+	if !ok {
+		return
+	}
+
+	switch m.Kind {
+	case reply:
+		conn.Write(m.Data)
+	case join:
+		if c, ok := conn.(client.Client); ok {
+			b.hub.Join <- client.Membership{Client: c, Room: m.Room}
+		}
+	case drop:
+		if c, ok := conn.(disconnecter); ok {
+			c.Disconnect()
+		}
+	}
+}
+
+func (b *Bridge) idOf(conn io.WriteCloser) int64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if id, ok := b.ids[conn]; ok {
+		return id
+	}
+
+	b.next++
+	b.ids[conn] = b.next
+	b.conns[b.next] = conn
+	return b.next
+}
+
+func (b *Bridge) forget(conn io.WriteCloser) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.conns, b.ids[conn])
+	delete(b.ids, conn)
+}
@@ -0,0 +1,82 @@
+package cluster
+
+import (
+	"bitbucket.org/jahfer/flux-middleman/packet"
+	"encoding/json"
+	"fmt"
+)
+
+// A phone connected to an edge, as seen by the primary. Writes are
+// passed on to the edge holding the connection.
+type Remote struct {
+	Instance string
+	Conn     int64
+}
+
+func (r *Remote) Write(b []byte) (int, error) {
+	err := publish(instanceChannel(r.Instance), message{Kind: reply, Conn: r.Conn, Data: b})
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// The edge closes the connection when the phone goes away
+func (r *Remote) Close() error {
+	return nil
+}
+
+// Have the edge drop the phone
+func (r *Remote) Disconnect() error {
+	return publish(instanceChannel(r.Instance), message{Kind: drop, Conn: r.Conn})
+}
+
+// Move the phone into a hub room on its edge, so it gets the room's
+// broadcasts
+func (r *Remote) Join(room string) error {
+	return publish(instanceChannel(r.Instance), message{Kind: join, Conn: r.Conn, Room: room})
+}
+
+// Feed events from phones on the edges into incoming, as though the
+// phones were connected here. Each phone is always the same *Remote,
+// so rate limits and rosters work as usual.
+func ListenPrimary(incoming chan packet.In) error {
+	remotes := make(map[Remote]*Remote)
+
+	return listen(eventsChannel(), func(m message) {
+		key := Remote{Instance: m.From, Conn: m.Conn}
+
+		remote, ok := remotes[key]
+		if !ok {
+			remote = &Remote{Instance: m.From, Conn: m.Conn}
+			remotes[key] = remote
+		}
+
+		switch m.Kind {
+		case event:
+			incoming <- packet.In{Raw: m.Data, Sender: remote}
+		case dead:
+			delete(remotes, key)
+			// same as a phone here disconnecting
+			incoming <- packet.In{Sender: remote}
+		}
+	})
+}
+
+// Pass a message for a hub room's phones on to the edges; does nothing
+// unless this server is the primary
+func Broadcast(room string, msg interface{}) {
+	if Role != Primary {
+		return
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		fmt.Printf("[ERROR]\tCould not encode broadcast for the cluster. %v\n", err)
+		return
+	}
+
+	if err := publish(broadcastChannel(), message{Kind: broadcast, Room: room, Data: data}); err != nil {
+		fmt.Printf("[ERROR]\tCould not send broadcast to the cluster. %v\n", err)
+	}
+}
@@ -0,0 +1,192 @@
+package cooldown
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Number of times a team may use an action within a window
+type Budget struct {
+	Actions int
+	Per     time.Duration
+}
+
+// Keeps players to a minimum time between actions, and teams within
+// their action budgets
+type Tracker struct {
+	mutex     sync.Mutex
+	cooldowns map[string]time.Duration
+	budgets   map[string]Budget
+	// action -> user id -> last accepted use
+	lastUse map[string]map[int]time.Time
+	// action -> team id -> accepted uses still inside the window
+	teamUses map[string]map[int][]time.Time
+	// action -> user id -> accepted use that hasn't been ended yet
+	open map[string]map[int]bool
+}
+
+func NewTracker(cooldowns map[string]time.Duration, budgets map[string]Budget) *Tracker {
+	t := &Tracker{
+		cooldowns: make(map[string]time.Duration),
+		budgets:   make(map[string]Budget),
+		lastUse:   make(map[string]map[int]time.Time),
+		teamUses:  make(map[string]map[int][]time.Time),
+		open:      make(map[string]map[int]bool),
+	}
+
+	for action, d := range cooldowns {
+		t.cooldowns[action] = d
+	}
+	for action, b := range budgets {
+		t.budgets[action] = b
+	}
+
+	return t
+}
+
+// Use the action if the player and their team are allowed to;
+// otherwise report how long until they are
+func (t *Tracker) Try(action string, userId, teamId int) (ok bool, remaining time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+
+	if d, limited := t.cooldowns[action]; limited {
+		if last, used := t.lastUse[action][userId]; used {
+			if wait := last.Add(d).Sub(now); wait > 0 {
+				return false, wait
+			}
+		}
+	}
+
+	var uses []time.Time
+	b, budgeted := t.budgets[action]
+	if budgeted {
+		// drop uses that have left the window
+		for _, used := range t.teamUses[action][teamId] {
+			if now.Sub(used) < b.Per {
+				uses = append(uses, used)
+			}
+		}
+
+		if len(uses) >= b.Actions {
+			return false, uses[0].Add(b.Per).Sub(now)
+		}
+	}
+
+	if _, exists := t.lastUse[action]; !exists {
+		t.lastUse[action] = make(map[int]time.Time)
+		t.open[action] = make(map[int]bool)
+	}
+	t.lastUse[action][userId] = now
+	t.open[action][userId] = true
+
+	if budgeted {
+		if _, exists := t.teamUses[action]; !exists {
+			t.teamUses[action] = make(map[int][]time.Time)
+		}
+		t.teamUses[action][teamId] = append(uses, now)
+	}
+
+	return true, 0
+}
+
+// End the player's use of an action held until it's let go, e.g. bloat
+// until bloatEnd. False when the use was turned down, or already ended.
+func (t *Tracker) End(action string, userId int) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.open[action][userId] {
+		return false
+	}
+	delete(t.open[action], userId)
+	return true
+}
+
+// Drop everything kept for the player, once they've left
+func (t *Tracker) ForgetUser(userId int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for action := range t.lastUse {
+		delete(t.lastUse[action], userId)
+		delete(t.open[action], userId)
+	}
+}
+
+// Drop the team's budget use, once it's gone
+func (t *Tracker) ForgetTeam(teamId int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for action := range t.teamUses {
+		delete(t.teamUses[action], teamId)
+	}
+}
+
+// Parse cooldowns in the form "attack=1s,shoot=200ms"
+func ParseCooldowns(s string) (map[string]time.Duration, error) {
+	cooldowns := make(map[string]time.Duration)
+
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("Invalid cooldown: " + entry)
+		}
+
+		d, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return nil, errors.New("Invalid cooldown: " + entry)
+		}
+
+		cooldowns[parts[0]] = d
+	}
+
+	return cooldowns, nil
+}
+
+// Parse team budgets in the form "attack=10/5s,bloat=4/10s"
+func ParseBudgets(s string) (map[string]Budget, error) {
+	budgets := make(map[string]Budget)
+
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("Invalid budget: " + entry)
+		}
+
+		values := strings.SplitN(parts[1], "/", 2)
+		if len(values) != 2 {
+			return nil, errors.New("Invalid budget: " + entry)
+		}
+
+		actions, err := strconv.Atoi(values[0])
+		if err != nil || actions < 1 {
+			return nil, errors.New("Invalid budget: " + entry)
+		}
+
+		per, err := time.ParseDuration(values[1])
+		if err != nil {
+			return nil, errors.New("Invalid budget: " + entry)
+		}
+
+		budgets[parts[0]] = Budget{actions, per}
+	}
+
+	return budgets, nil
+}
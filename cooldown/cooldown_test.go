@@ -0,0 +1,96 @@
+package cooldown
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCooldownPerUser(t *testing.T) {
+	tr := NewTracker(map[string]time.Duration{"attack": time.Hour}, nil)
+
+	if ok, _ := tr.Try("attack", 1, 0); !ok {
+		t.Fatalf("First attack was rejected")
+	}
+
+	ok, remaining := tr.Try("attack", 1, 0)
+	if ok {
+		t.Errorf("Second attack went through during the cooldown")
+	}
+	if remaining <= 0 || remaining > time.Hour {
+		t.Errorf("Got %v remaining, expected up to an hour", remaining)
+	}
+
+	if ok, _ := tr.Try("attack", 2, 0); !ok {
+		t.Errorf("Cooldown leaked to a teammate")
+	}
+	if ok, _ := tr.Try("shoot", 1, 0); !ok {
+		t.Errorf("Action without a cooldown was rejected")
+	}
+}
+
+func TestTeamBudget(t *testing.T) {
+	tr := NewTracker(nil, map[string]Budget{"bloat": {2, time.Hour}})
+
+	tr.Try("bloat", 1, 0)
+	tr.Try("bloat", 2, 0)
+
+	if ok, _ := tr.Try("bloat", 3, 0); ok {
+		t.Errorf("Team went over its budget")
+	}
+	if ok, _ := tr.Try("bloat", 4, 1); !ok {
+		t.Errorf("Budget leaked to another team")
+	}
+}
+
+func TestParse(t *testing.T) {
+	cooldowns, err := ParseCooldowns("attack=1s, shoot=200ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cooldowns["attack"] != time.Second || cooldowns["shoot"] != 200*time.Millisecond {
+		t.Errorf("Got %v", cooldowns)
+	}
+
+	budgets, err := ParseBudgets("attack=10/5s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := budgets["attack"]; b.Actions != 10 || b.Per != 5*time.Second {
+		t.Errorf("Got %+v", b)
+	}
+
+	if _, err := ParseBudgets("attack=10"); err == nil {
+		t.Errorf("Expected an error for a budget without a window")
+	}
+}
+
+func TestOnlyAcceptedUsesEnd(t *testing.T) {
+	tr := NewTracker(map[string]time.Duration{"bloat": time.Minute}, nil)
+
+	tr.Try("bloat", 1, 0)
+	if ok, _ := tr.Try("bloat", 1, 0); ok {
+		t.Fatalf("Second bloat got through its cooldown")
+	}
+
+	if !tr.End("bloat", 1) {
+		t.Errorf("Accepted bloat could not be ended")
+	}
+	if tr.End("bloat", 1) {
+		t.Errorf("Turned down bloat was ended")
+	}
+}
+
+func TestForget(t *testing.T) {
+	tr := NewTracker(map[string]time.Duration{"attack": time.Minute}, map[string]Budget{"attack": {1, time.Minute}})
+
+	tr.Try("attack", 1, 0)
+	tr.ForgetUser(1)
+	tr.ForgetTeam(0)
+
+	if len(tr.lastUse["attack"]) != 0 || len(tr.teamUses["attack"]) != 0 {
+		t.Errorf("Kept %v and %v", tr.lastUse, tr.teamUses)
+	}
+	if ok, _ := tr.Try("attack", 1, 0); !ok {
+		t.Errorf("Forgotten player and team were still held back")
+	}
+}
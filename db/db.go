@@ -1,105 +1,140 @@
 package db
 
 import (
+	"bitbucket.org/jahfer/flux-middleman/keys"
 	"fmt"
-	r "github.com/vmihailenco/redis"
-	"github.com/ziutek/mymysql/mysql"
-	_ "github.com/ziutek/mymysql/native"
-	"net"
-	"time"
-	"os/exec"
 )
 
-var Redis *r.Client
-
-func Init() {
-	srvAddr := "localhost:6379"
-
-	Redis = r.NewTCPClient(srvAddr, "", -1)
-
-	tcpAddr, _ := net.ResolveTCPAddr("tcp", srvAddr)
+// Where everything is kept; Init connects to Redis unless another
+// store has been set beforehand
+var Client Store
+
+// What happens to data left over from the last run
+const (
+	// clear the server's keys
+	Fresh = "fresh"
+	// clear them, except for the saved team snapshots
+	Resume = "resume"
+	// leave everything as it is
+	Keep = "keep"
+)
 
-	if _, err := net.DialTCP("tcp", nil, tcpAddr); err != nil {
-		fmt.Printf(" [NOTICE]\tRedis server not connected.\n")
-		fmt.Printf(" [NOTICE]\tAttempting to boot up Redis server.\n")
+var Startup = Fresh
 
-		response := make(chan bool, 1)
+func IsStartup(mode string) bool {
+	return mode == Fresh || mode == Resume || mode == Keep
+}
 
-		go bootRedisServer(response);
+func Init() {
+	if Client == nil {
+		connectRedis()
+	}
 
-		<-response
-		fmt.Printf(" [NOTICE]\tRedis server has connected.\n")
+	if Startup == Keep {
+		return
 	}
-	
-	// clear stale data
-	Redis.FlushDb()
-}
 
-func bootRedisServer(resp chan bool) {
-	cmd := exec.Command("redis-server")
+	var kept []string
+	if Startup == Resume {
+		kept = append(kept, keys.Snapshots())
+	}
 
-	if err := cmd.Start(); err != nil {
-		fmt.Printf(" [ERROR]\tCould not connect to Redis server.\n")
-		fmt.Println(err.Error())
-		panic(1)
+	cleared, err := clear(keys.Owned(), kept)
+	if err != nil {
+		panic(err)
 	}
+	fmt.Printf(" [NOTICE]\tCleared %v keys left from the last run.\n", cleared)
+}
 
-	time.Sleep(50 * time.Millisecond)
+// Delete the keys matching any of the patterns, other than those
+// matching one to keep. Only touches the server's own keys, unlike
+// FlushDb, so other data sharing the database survives.
+func clear(patterns, kept []string) (cleared int, err error) {
+	for _, pattern := range patterns {
+		err = scan(pattern, func(page []string) error {
+			var doomed []string
+			for _, key := range page {
+				if !matchesAny(key, kept) {
+					doomed = append(doomed, key)
+				}
+			}
 
-	resp <- true
+			if len(doomed) == 0 {
+				return nil
+			}
+			if err := Client.Del(doomed...); err != nil {
+				return err
+			}
+			cleared += len(doomed)
+			return nil
+		})
 
-	if err := cmd.Wait(); err != nil {
-		fmt.Printf(" [ERROR]\tRedis server disconnected.\n")
-		panic(2);
+		if err != nil {
+			return
+		}
 	}
-}
 
-func Close() {
-	Redis.Close();
+	return cleared, nil
 }
 
-func Examples() {
+// Delete every key matching the pattern
+func Clear(pattern string) (int, error) {
+	return clear([]string{pattern}, nil)
+}
 
-	/* == CONNECT MYSQL DATABASE == */
-	mysqluser := "root"
-	mysqlpass := "root"
-	mysqldb := "flux"
+// Every key matching the pattern. Unlike KEYS, the search is done a
+// page at a time, so Redis keeps serving everyone else meanwhile.
+func Find(pattern string) (found []string, err error) {
+	err = scan(pattern, func(page []string) error {
+		found = append(found, page...)
+		return nil
+	})
+	return
+}
 
-	db := mysql.New("tcp", "", "127.0.0.1:8889", mysqluser, mysqlpass, mysqldb)
+// Keys asked for per page
+const scanCount = 500
 
-	err := db.Connect()
-	if err != nil {
-		panic(err.Error())
-	}
+// Hand each page of keys matching the pattern to fn, leaving out keys
+// already seen
+func scan(pattern string, fn func(page []string) error) error {
+	seen := make(map[string]bool)
+	var cursor int64
 
-	/* == TEST MYSQL == */
-	// submit a new user
-	/*u := &user.User{Name: "John Doe", Id: 10}
-	newUser, err := db.Prepare("INSERT INTO users (name) VALUES (?)")
-	_, err = newUser.Run(u.Name)
-	if err != nil {
-		panic(err.Error())
-	}*/
-
-	// get all users
-	rows, res, err := db.Query("SELECT * FROM users")
-	if err != nil {
-		panic(err.Error())
-	}
+	for {
+		next, found, err := Client.Scan(cursor, pattern, scanCount)
+		if err != nil {
+			return err
+		}
 
-	for _, row := range rows {
-		for _, col := range row {
-			if col == nil {
-				// ...
-			} else {
-				//fmt.Println(col)
+		var page []string
+		for _, key := range found {
+			if !seen[key] {
+				seen[key] = true
+				page = append(page, key)
 			}
 		}
 
-		id := res.Map("id")
-		name := res.Map("name")
+		if err := fn(page); err != nil {
+			return err
+		}
 
-		fmt.Println("Data collected:", row.Int(id), row.Str(name))
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
 
+func matchesAny(key string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if Match(pattern, key) {
+			return true
+		}
 	}
+	return false
+}
+
+func Close() {
+	Client.Close();
 }
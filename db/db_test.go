@@ -0,0 +1,75 @@
+package db
+
+import (
+	"bitbucket.org/jahfer/flux-middleman/keys"
+	"testing"
+)
+
+func TestInitOnlyClearsOwnKeys(t *testing.T) {
+	Client = NewMemory()
+	defer func() { Client, Startup, keys.Prefix = nil, Fresh, "" }()
+
+	keys.Prefix = "flux:"
+	k := keys.ForRoom("ABCD")
+
+	Client.Set(k.User(1).Points(), "10")
+	Client.Set(k.Snapshot(), "{}")
+	Client.Set("someone:else", "x")
+
+	Startup = Resume
+	Init()
+
+	if _, err := Client.Get(k.User(1).Points()); err != Nil {
+		t.Errorf("Player's points survived a restart")
+	}
+	if _, err := Client.Get(k.Snapshot()); err != nil {
+		t.Errorf("Snapshot was cleared when resuming")
+	}
+	if _, err := Client.Get("someone:else"); err != nil {
+		t.Errorf("Key outside the namespace was cleared")
+	}
+
+	Startup = Fresh
+	Init()
+
+	if _, err := Client.Get(k.Snapshot()); err != Nil {
+		t.Errorf("Snapshot survived a fresh start")
+	}
+}
+
+func TestInitKeep(t *testing.T) {
+	Client = NewMemory()
+	defer func() { Client, Startup = nil, Fresh }()
+
+	Client.Set(keys.ForRoom("").NextUserId(), "7")
+
+	Startup = Keep
+	Init()
+
+	if GetInt(keys.ForRoom("").NextUserId()) != 7 {
+		t.Errorf("Data was cleared while keeping")
+	}
+}
+
+func TestInitFreshWithoutPrefix(t *testing.T) {
+	Client = NewMemory()
+	defer func() { Client, Startup = nil, Fresh }()
+
+	k := keys.ForRoom("")
+	Client.Set(k.NextUserId(), "7")
+	Client.Set(k.User(1).Points(), "10")
+	Client.Set("someone:else", "x")
+
+	Startup = Fresh
+	Init()
+
+	if _, err := Client.Get(k.NextUserId()); err != Nil {
+		t.Errorf("Id counter survived a fresh start")
+	}
+	if _, err := Client.Get(k.User(1).Points()); err != Nil {
+		t.Errorf("Player's points survived a fresh start")
+	}
+	if _, err := Client.Get("someone:else"); err != nil {
+		t.Errorf("Key that isn't ours was cleared")
+	}
+}
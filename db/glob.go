@@ -0,0 +1,90 @@
+package db
+
+// Whether the key matches the pattern the way Redis would match it for
+// KEYS and SCAN: * and ? match any characters, / included, [abc], [^a]
+// and [a-z] match sets of characters and \ escapes the next one
+func Match(pattern, key string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(key); i++ {
+				if Match(pattern[1:], key[i:]) {
+					return true
+				}
+			}
+			return false
+
+		case '?':
+			if len(key) == 0 {
+				return false
+			}
+
+		case '[':
+			if len(key) == 0 {
+				return false
+			}
+			var ok bool
+			if ok, pattern = matchSet(pattern[1:], key[0]); !ok {
+				return false
+			}
+			// pattern is left on the closing ]
+
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+
+		default:
+			if len(key) == 0 || pattern[0] != key[0] {
+				return false
+			}
+		}
+
+		pattern = pattern[1:]
+		key = key[1:]
+	}
+
+	return len(key) == 0
+}
+
+// Match c against the set starting just after a [, returning the
+// pattern from the closing ] on
+func matchSet(pattern string, c byte) (bool, string) {
+	not := len(pattern) > 0 && pattern[0] == '^'
+	if not {
+		pattern = pattern[1:]
+	}
+
+	match := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) > 1:
+			pattern = pattern[1:]
+			match = match || pattern[0] == c
+		case len(pattern) > 2 && pattern[1] == '-' && pattern[2] != ']':
+			lo, hi := pattern[0], pattern[2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			match = match || (c >= lo && c <= hi)
+			pattern = pattern[2:]
+		default:
+			match = match || pattern[0] == c
+		}
+		pattern = pattern[1:]
+	}
+
+	// an unclosed set runs to the end of the pattern
+	if len(pattern) == 0 {
+		pattern = "]"
+	}
+
+	return match != not, pattern
+}
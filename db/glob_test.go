@@ -0,0 +1,32 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestMatchLikeRedis(t *testing.T) {
+	cases := []struct {
+		pattern, key string
+		want         bool
+	}{
+		{"flux:*", "flux:room:AB/CD:uid:1:points", true},
+		{"*global:snapshot", "flux:room:ABCD:global:snapshot", true},
+		{"*global:snapshot", "flux:global:snapshot:old", false},
+		{"uid:?:team", "uid:1:team", true},
+		{"uid:?:team", "uid:12:team", false},
+		{"room:[A-C]*", "room:BCDE:x", true},
+		{"room:[^A-C]*", "room:BCDE:x", false},
+		{"room:[xyz]", "room:y", true},
+		{`a\*b`, "a*b", true},
+		{`a\*b`, "axb", false},
+		{"a**b", "a/b", true},
+		{"", "", true},
+		{"", "a", false},
+	}
+
+	for _, c := range cases {
+		if got := Match(c.pattern, c.key); got != c.want {
+			t.Errorf("Match(%q, %q) = %v, expected %v", c.pattern, c.key, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,599 @@
+package db
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Store kept entirely in process memory
+type memoryStore struct {
+	mutex sync.Mutex
+	// string, map[string]string (hash), []string (list),
+	// map[string]bool (set) or map[string]float64 (sorted set)
+	data map[string]interface{}
+	// channel -> subscribers
+	subs map[string][]chan string
+}
+
+func NewMemory() Store {
+	return &memoryStore{
+		data: make(map[string]interface{}),
+		subs: make(map[string][]chan string),
+	}
+}
+
+func (s *memoryStore) Get(key string) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	v, ok := s.data[key]
+	if !ok {
+		return "", Nil
+	}
+	str, ok := v.(string)
+	if !ok {
+		return "", ErrWrongType
+	}
+	return str, nil
+}
+
+func (s *memoryStore) Set(key, value string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.data[key] = value
+	return nil
+}
+
+func (s *memoryStore) SetNX(key, value string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.data[key]; exists {
+		return false, nil
+	}
+	s.data[key] = value
+	return true, nil
+}
+
+func (s *memoryStore) Del(keys ...string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, key := range keys {
+		delete(s.data, key)
+	}
+	return nil
+}
+
+func (s *memoryStore) Keys(pattern string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var keys []string
+	for key := range s.data {
+		if Match(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Everything fits on the first page
+func (s *memoryStore) Scan(cursor int64, pattern string, count int64) (int64, []string, error) {
+	keys, err := s.Keys(pattern)
+	return 0, keys, err
+}
+
+func (s *memoryStore) Incr(key string) (int64, error) {
+	return s.IncrBy(key, 1)
+}
+
+func (s *memoryStore) IncrBy(key string, n int64) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var cur int64
+	if v, ok := s.data[key]; ok {
+		str, ok := v.(string)
+		if !ok {
+			return 0, ErrWrongType
+		}
+		var err error
+		if cur, err = strconv.ParseInt(str, 10, 64); err != nil {
+			return 0, errors.New("db: value is not an integer")
+		}
+	}
+
+	cur += n
+	s.data[key] = strconv.FormatInt(cur, 10)
+	return cur, nil
+}
+
+func (s *memoryStore) HSet(key, field, value string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	h, err := s.hash(key, true)
+	if err != nil {
+		return err
+	}
+	h[field] = value
+	return nil
+}
+
+func (s *memoryStore) HGetAll(key string) (map[string]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	h, err := s.hash(key, false)
+	if err != nil {
+		return nil, err
+	}
+
+	all := make(map[string]string, len(h))
+	for field, value := range h {
+		all[field] = value
+	}
+	return all, nil
+}
+
+func (s *memoryStore) LPush(key string, values ...string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	list, err := s.list(key)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range values {
+		list = append([]string{v}, list...)
+	}
+	s.data[key] = list
+	return nil
+}
+
+func (s *memoryStore) LRange(key string, start, stop int64) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	list, err := s.list(key)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to, ok := span(len(list), start, stop)
+	if !ok {
+		return []string{}, nil
+	}
+	return append([]string{}, list[from:to]...), nil
+}
+
+func (s *memoryStore) LTrim(key string, start, stop int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	list, err := s.list(key)
+	if err != nil {
+		return err
+	}
+
+	from, to, ok := span(len(list), start, stop)
+	if !ok {
+		delete(s.data, key)
+		return nil
+	}
+	s.data[key] = append([]string{}, list[from:to]...)
+	return nil
+}
+
+func (s *memoryStore) SAdd(key string, members ...string) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	set, err := s.set(key, true)
+	if err != nil {
+		return 0, err
+	}
+
+	var added int64
+	for _, m := range members {
+		if !set[m] {
+			set[m] = true
+			added++
+		}
+	}
+	return added, nil
+}
+
+func (s *memoryStore) SRem(key string, members ...string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	set, err := s.set(key, false)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range members {
+		delete(set, m)
+	}
+	if len(set) == 0 {
+		delete(s.data, key)
+	}
+	return nil
+}
+
+func (s *memoryStore) SMembers(key string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	set, err := s.set(key, false)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]string, 0, len(set))
+	for m := range set {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+func (s *memoryStore) SCard(key string) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	set, err := s.set(key, false)
+	return int64(len(set)), err
+}
+
+func (s *memoryStore) SUnionStore(dest string, keys ...string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	union := make(map[string]bool)
+	for _, key := range keys {
+		set, err := s.set(key, false)
+		if err != nil {
+			return err
+		}
+		for m := range set {
+			union[m] = true
+		}
+	}
+
+	if len(union) == 0 {
+		delete(s.data, dest)
+	} else {
+		s.data[dest] = union
+	}
+	return nil
+}
+
+func (s *memoryStore) ZAdd(key string, score float64, member string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	z, err := s.zset(key, true)
+	if err != nil {
+		return err
+	}
+	z[member] = score
+	return nil
+}
+
+func (s *memoryStore) ZIncrBy(key string, incr float64, member string) (float64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	z, err := s.zset(key, true)
+	if err != nil {
+		return 0, err
+	}
+	z[member] += incr
+	return z[member], nil
+}
+
+func (s *memoryStore) ZRem(key string, members ...string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	z, err := s.zset(key, false)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range members {
+		delete(z, m)
+	}
+	if len(z) == 0 {
+		delete(s.data, key)
+	}
+	return nil
+}
+
+func (s *memoryStore) ZCard(key string) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	z, err := s.zset(key, false)
+	return int64(len(z)), err
+}
+
+func (s *memoryStore) ZRangeByScore(key, min, max string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	z, err := s.zset(key, false)
+	if err != nil {
+		return nil, err
+	}
+
+	lo, loOpen, err := parseBound(min)
+	if err != nil {
+		return nil, err
+	}
+	hi, hiOpen, err := parseBound(max)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []string
+	for _, m := range sorted(z) {
+		if m.Score < lo || (loOpen && m.Score == lo) {
+			continue
+		}
+		if m.Score > hi || (hiOpen && m.Score == hi) {
+			continue
+		}
+		members = append(members, m.Member)
+	}
+	return members, nil
+}
+
+func (s *memoryStore) ZRevRangeWithScores(key string, start, stop int64) ([]Z, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	z, err := s.zset(key, false)
+	if err != nil {
+		return nil, err
+	}
+
+	members := reverse(sorted(z))
+	from, to, ok := span(len(members), start, stop)
+	if !ok {
+		return []Z{}, nil
+	}
+	return members[from:to], nil
+}
+
+func (s *memoryStore) ZRevRank(key, member string) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	z, err := s.zset(key, false)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, m := range reverse(sorted(z)) {
+		if m.Member == member {
+			return int64(i), nil
+		}
+	}
+	return 0, Nil
+}
+
+// Nothing to save by batching in memory; writes are applied as they come
+func (s *memoryStore) Pipelined(fn func(b Batch)) error {
+	var err error
+	fn(memoryBatch{s, &err})
+	return err
+}
+
+// Applies writes straight away, keeping the first error
+type memoryBatch struct {
+	s   *memoryStore
+	err *error
+}
+
+func (b memoryBatch) keep(err error) {
+	if err != nil && *b.err == nil {
+		*b.err = err
+	}
+}
+
+func (b memoryBatch) Set(key, value string)         { b.keep(b.s.Set(key, value)) }
+func (b memoryBatch) Del(keys ...string)            { b.keep(b.s.Del(keys...)) }
+func (b memoryBatch) HSet(key, field, value string) { b.keep(b.s.HSet(key, field, value)) }
+func (b memoryBatch) SRem(key string, members ...string) {
+	b.keep(b.s.SRem(key, members...))
+}
+func (b memoryBatch) ZRem(key string, members ...string) {
+	b.keep(b.s.ZRem(key, members...))
+}
+func (b memoryBatch) SAdd(key string, members ...string) {
+	_, err := b.s.SAdd(key, members...)
+	b.keep(err)
+}
+func (b memoryBatch) ZAdd(key string, score float64, member string) {
+	b.keep(b.s.ZAdd(key, score, member))
+}
+
+func (s *memoryStore) Publish(channel, message string) error {
+	s.mutex.Lock()
+	subs := append([]chan string{}, s.subs[channel]...)
+	s.mutex.Unlock()
+
+	// delivered outside the lock, so a slow subscriber can't hold up
+	// the rest of the store
+	for _, sub := range subs {
+		sub <- message
+	}
+	return nil
+}
+
+func (s *memoryStore) Subscribe(channel string) (<-chan string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sub := make(chan string, 256)
+	s.subs[channel] = append(s.subs[channel], sub)
+	return sub, nil
+}
+
+func (s *memoryStore) Ping() error {
+	return nil
+}
+
+func (s *memoryStore) FlushDb() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.data = make(map[string]interface{})
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+// Typed lookups; missing keys come back empty, and create asks for
+// the value to be stored so it can be filled in
+
+func (s *memoryStore) hash(key string, create bool) (map[string]string, error) {
+	v, ok := s.data[key]
+	if !ok {
+		h := make(map[string]string)
+		if create {
+			s.data[key] = h
+		}
+		return h, nil
+	}
+	h, ok := v.(map[string]string)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return h, nil
+}
+
+func (s *memoryStore) list(key string) ([]string, error) {
+	v, ok := s.data[key]
+	if !ok {
+		return nil, nil
+	}
+	list, ok := v.([]string)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return list, nil
+}
+
+func (s *memoryStore) set(key string, create bool) (map[string]bool, error) {
+	v, ok := s.data[key]
+	if !ok {
+		set := make(map[string]bool)
+		if create {
+			s.data[key] = set
+		}
+		return set, nil
+	}
+	set, ok := v.(map[string]bool)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return set, nil
+}
+
+func (s *memoryStore) zset(key string, create bool) (map[string]float64, error) {
+	v, ok := s.data[key]
+	if !ok {
+		z := make(map[string]float64)
+		if create {
+			s.data[key] = z
+		}
+		return z, nil
+	}
+	z, ok := v.(map[string]float64)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return z, nil
+}
+
+// Turn redis-style inclusive, possibly negative, indexes into a slice range
+func span(length int, start, stop int64) (from, to int, ok bool) {
+	n := int64(length)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop || start >= n {
+		return 0, 0, false
+	}
+	return int(start), int(stop + 1), true
+}
+
+func parseBound(b string) (score float64, open bool, err error) {
+	if strings.HasPrefix(b, "(") {
+		open, b = true, b[1:]
+	}
+
+	switch b {
+	case "-inf":
+		return math.Inf(-1), open, nil
+	case "+inf", "inf":
+		return math.Inf(1), open, nil
+	}
+
+	score, err = strconv.ParseFloat(b, 64)
+	if err != nil {
+		return 0, false, errors.New("db: min or max is not a float")
+	}
+	return score, open, nil
+}
+
+// lowest score first, ties by member
+type byScore []Z
+
+func (z byScore) Len() int      { return len(z) }
+func (z byScore) Swap(i, j int) { z[i], z[j] = z[j], z[i] }
+func (z byScore) Less(i, j int) bool {
+	if z[i].Score != z[j].Score {
+		return z[i].Score < z[j].Score
+	}
+	return z[i].Member < z[j].Member
+}
+
+func sorted(z map[string]float64) []Z {
+	members := make(byScore, 0, len(z))
+	for m, score := range z {
+		members = append(members, Z{Member: m, Score: score})
+	}
+	sort.Sort(members)
+	return members
+}
+
+func reverse(members []Z) []Z {
+	for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+		members[i], members[j] = members[j], members[i]
+	}
+	return members
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMemoryKeyValue(t *testing.T) {
+	s := NewMemory()
+
+	if _, err := s.Get("missing"); err != Nil {
+		t.Errorf("Expected Nil for a missing key, got %v", err)
+	}
+
+	s.Set("global:nextUserId", "4")
+	if n, _ := s.Incr("global:nextUserId"); n != 5 {
+		t.Errorf("Got %v after Incr, expected 5", n)
+	}
+
+	if ok, _ := s.SetNX("global:nextUserId", "0"); ok {
+		t.Errorf("SetNX replaced an existing key")
+	}
+
+	s.Set("uid:1:points", "10")
+	s.Set("uid:2:points", "10")
+	if keys, _ := s.Keys("uid:*:points"); !reflect.DeepEqual(keys, []string{"uid:1:points", "uid:2:points"}) {
+		t.Errorf("Got keys %v", keys)
+	}
+
+	s.Del("uid:1:points", "uid:2:points")
+	if keys, _ := s.Keys("uid:*"); len(keys) != 0 {
+		t.Errorf("Keys left after Del: %v", keys)
+	}
+
+	s.SAdd("team:0:users", "1")
+	if _, err := s.Get("team:0:users"); err != ErrWrongType {
+		t.Errorf("Expected ErrWrongType reading a set as a string, got %v", err)
+	}
+}
+
+func TestMemoryLists(t *testing.T) {
+	s := NewMemory()
+
+	s.LPush("ledger", "a", "b", "c")
+	s.LTrim("ledger", 0, 1)
+
+	if got, _ := s.LRange("ledger", 0, -1); !reflect.DeepEqual(got, []string{"c", "b"}) {
+		t.Errorf("Got %v, expected [c b]", got)
+	}
+}
+
+func TestMemorySets(t *testing.T) {
+	s := NewMemory()
+
+	if added, _ := s.SAdd("badges", "theOcho", "firstMerge", "theOcho"); added != 2 {
+		t.Errorf("Added %v members, expected 2", added)
+	}
+
+	s.SAdd("team:1:users", "3")
+	s.SAdd("team:2:users", "4")
+	s.SUnionStore("team:1:users", "team:1:users", "team:2:users")
+
+	if got, _ := s.SMembers("team:1:users"); !reflect.DeepEqual(got, []string{"3", "4"}) {
+		t.Errorf("Got %v after union", got)
+	}
+
+	s.SRem("team:1:users", "3")
+	if n, _ := s.SCard("team:1:users"); n != 1 {
+		t.Errorf("Got %v members after SRem, expected 1", n)
+	}
+}
+
+func TestMemorySortedSets(t *testing.T) {
+	s := NewMemory()
+
+	s.ZAdd("clients", 100, "1")
+	s.ZAdd("clients", 200, "2")
+	s.ZIncrBy("clients", 150, "3")
+
+	if got, _ := s.ZRangeByScore("clients", "-inf", "150"); !reflect.DeepEqual(got, []string{"1", "3"}) {
+		t.Errorf("Got %v, expected [1 3]", got)
+	}
+	if got, _ := s.ZRangeByScore("clients", "(100", "+inf"); !reflect.DeepEqual(got, []string{"3", "2"}) {
+		t.Errorf("Got %v, expected [3 2]", got)
+	}
+
+	top, _ := s.ZRevRangeWithScores("clients", 0, 1)
+	if expected := []Z{{"2", 200}, {"3", 150}}; !reflect.DeepEqual(top, expected) {
+		t.Errorf("Got %v, expected %v", top, expected)
+	}
+
+	if rank, _ := s.ZRevRank("clients", "1"); rank != 2 {
+		t.Errorf("Got rank %v, expected 2", rank)
+	}
+	if _, err := s.ZRevRank("clients", "9"); err != Nil {
+		t.Errorf("Expected Nil rank for a missing member, got %v", err)
+	}
+
+	s.ZRem("clients", "1", "2", "3")
+	if n, _ := s.ZCard("clients"); n != 0 {
+		t.Errorf("Got %v members after ZRem", n)
+	}
+}
+
+func TestMemoryPubSub(t *testing.T) {
+	s := NewMemory()
+
+	a, _ := s.Subscribe("cluster:events")
+	b, _ := s.Subscribe("cluster:events")
+	other, _ := s.Subscribe("cluster:broadcast")
+
+	s.Publish("cluster:events", "hello")
+
+	for _, sub := range []<-chan string{a, b} {
+		if msg := <-sub; msg != "hello" {
+			t.Errorf("Got %q, expected hello", msg)
+		}
+	}
+
+	select {
+	case msg := <-other:
+		t.Errorf("Got %q on a different channel", msg)
+	default:
+	}
+}
@@ -0,0 +1,431 @@
+package db
+
+import (
+	"fmt"
+	r "github.com/vmihailenco/redis"
+	"io"
+	"net"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// How to reach Redis
+type RedisConfig struct {
+	Addr     string
+	Password string
+	// -1 stays on the server's default database
+	DB       int64
+	PoolSize int
+
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// start a local redis-server when nothing is listening on Addr
+	Spawn bool
+	// tries on boot before giving up
+	ConnectAttempts int
+	// longest wait between reconnection attempts
+	MaxBackoff time.Duration
+}
+
+var RedisOptions = RedisConfig{
+	Addr:            "localhost:6379",
+	DB:              -1,
+	PoolSize:        10,
+	DialTimeout:     5 * time.Second,
+	ReadTimeout:     3 * time.Second,
+	WriteTimeout:    3 * time.Second,
+	ConnectAttempts: 5,
+	MaxBackoff:      10 * time.Second,
+}
+
+// Store backed by a redis-server
+type redisStore struct {
+	c   *r.Client
+	cfg RedisConfig
+}
+
+func NewRedis(cfg RedisConfig) Store {
+	openConn := func() (io.ReadWriteCloser, error) {
+		conn, err := net.DialTimeout("tcp", cfg.Addr, cfg.DialTimeout)
+		if err != nil {
+			return nil, err
+		}
+		return &deadlineConn{conn, cfg.ReadTimeout, cfg.WriteTimeout}, nil
+	}
+	closeConn := func(conn io.ReadWriteCloser) error {
+		return conn.Close()
+	}
+
+	c := r.NewClient(openConn, closeConn, r.AuthSelectFunc(cfg.Password, cfg.DB))
+	if cfg.PoolSize > 0 {
+		c.ConnPool = r.NewMultiConnPool(openConn, closeConn, cfg.PoolSize)
+	}
+
+	return &redisStore{c, cfg}
+}
+
+// Gives every read and write its own deadline, so a dead server shows
+// up as an error instead of a hung handler
+type deadlineConn struct {
+	net.Conn
+	read  time.Duration
+	write time.Duration
+}
+
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	if c.read > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.read))
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *deadlineConn) Write(b []byte) (int, error) {
+	if c.write > 0 {
+		c.Conn.SetWriteDeadline(time.Now().Add(c.write))
+	}
+	return c.Conn.Write(b)
+}
+
+// Doubles the wait after every failure, up to a limit
+type backoff struct {
+	wait time.Duration
+	max  time.Duration
+}
+
+func (b *backoff) next() time.Duration {
+	if b.wait == 0 {
+		b.wait = 100 * time.Millisecond
+	} else if b.wait *= 2; b.wait > b.max {
+		b.wait = b.max
+	}
+	return b.wait
+}
+
+// Connect using RedisOptions, starting redis-server first if asked to,
+// then keep an eye on the connection. Panics if Redis can't be reached.
+func connectRedis() {
+	cfg := RedisOptions
+	Client = NewRedis(cfg)
+
+	if cfg.Spawn {
+		if conn, err := net.DialTimeout("tcp", cfg.Addr, cfg.DialTimeout); err != nil {
+			fmt.Printf(" [NOTICE]\tRedis server not connected.\n")
+			fmt.Printf(" [NOTICE]\tAttempting to boot up Redis server.\n")
+			go superviseRedisServer(cfg)
+		} else {
+			conn.Close()
+		}
+	}
+
+	b := backoff{max: cfg.MaxBackoff}
+	for attempt := 1; ; attempt++ {
+		err := Client.Ping()
+		if err == nil {
+			break
+		}
+		if attempt >= cfg.ConnectAttempts {
+			panic(fmt.Sprintf("Could not reach Redis at %v. %v", cfg.Addr, err))
+		}
+
+		wait := b.next()
+		fmt.Printf(" [NOTICE]\tRedis not reachable at %v, retrying in %v. %v\n", cfg.Addr, wait, err)
+		time.Sleep(wait)
+	}
+
+	fmt.Printf(" [NOTICE]\tRedis server has connected.\n")
+
+	go watchRedis(cfg)
+}
+
+// Ping Redis every few seconds; when it stops answering, keep trying
+// with a growing delay until it's back. The pool reconnects by itself,
+// so in the meantime commands just fail.
+func watchRedis(cfg RedisConfig) {
+	for {
+		time.Sleep(5 * time.Second)
+
+		err := Client.Ping()
+		if err == nil {
+			continue
+		}
+		fmt.Printf("[ERROR]\tLost connection to Redis. %v\n", err)
+
+		b := backoff{max: cfg.MaxBackoff}
+		for err != nil {
+			wait := b.next()
+			fmt.Printf("[NOTICE]\tRedis unreachable, retrying in %v. %v\n", wait, err)
+			time.Sleep(wait)
+			err = Client.Ping()
+		}
+
+		fmt.Printf("[NOTICE]\tReconnected to Redis.\n")
+	}
+}
+
+// Run a local redis-server, starting it again whenever it exits
+func superviseRedisServer(cfg RedisConfig) {
+	b := backoff{max: cfg.MaxBackoff}
+
+	for {
+		cmd := exec.Command("redis-server")
+		if err := cmd.Start(); err != nil {
+			fmt.Printf(" [ERROR]\tCould not start Redis server. %v\n", err)
+			return
+		}
+
+		started := time.Now()
+		err := cmd.Wait()
+
+		// it ran long enough to count as healthy
+		if time.Since(started) > cfg.MaxBackoff {
+			b = backoff{max: cfg.MaxBackoff}
+		}
+
+		wait := b.next()
+		fmt.Printf("[ERROR]\tRedis server exited, restarting in %v. %v\n", wait, err)
+		time.Sleep(wait)
+	}
+}
+
+// redis reports missing keys with its own error
+func redisErr(err error) error {
+	if err == r.Nil {
+		return Nil
+	}
+	return err
+}
+
+func (s *redisStore) Get(key string) (string, error) {
+	get := s.c.Get(key)
+	return get.Val(), redisErr(get.Err())
+}
+
+func (s *redisStore) Set(key, value string) error {
+	return s.c.Set(key, value).Err()
+}
+
+func (s *redisStore) SetNX(key, value string) (bool, error) {
+	res := s.c.SetNX(key, value)
+	return res.Val(), res.Err()
+}
+
+func (s *redisStore) Del(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return s.c.Del(keys...).Err()
+}
+
+func (s *redisStore) Keys(pattern string) ([]string, error) {
+	res := s.c.Keys(pattern)
+	return res.Val(), res.Err()
+}
+
+func (s *redisStore) Scan(cursor int64, pattern string, count int64) (int64, []string, error) {
+	res := s.c.Scan(cursor, pattern, count)
+	next, keys := res.Val()
+	return next, keys, res.Err()
+}
+
+func (s *redisStore) Incr(key string) (int64, error) {
+	res := s.c.Incr(key)
+	return res.Val(), res.Err()
+}
+
+func (s *redisStore) IncrBy(key string, n int64) (int64, error) {
+	res := s.c.IncrBy(key, n)
+	return res.Val(), res.Err()
+}
+
+func (s *redisStore) HSet(key, field, value string) error {
+	return s.c.HSet(key, field, value).Err()
+}
+
+func (s *redisStore) HGetAll(key string) (map[string]string, error) {
+	res := s.c.HGetAllMap(key)
+	return res.Val(), res.Err()
+}
+
+func (s *redisStore) LPush(key string, values ...string) error {
+	return s.c.LPush(key, values...).Err()
+}
+
+func (s *redisStore) LRange(key string, start, stop int64) ([]string, error) {
+	res := s.c.LRange(key, start, stop)
+	return res.Val(), res.Err()
+}
+
+func (s *redisStore) LTrim(key string, start, stop int64) error {
+	return s.c.LTrim(key, start, stop).Err()
+}
+
+func (s *redisStore) SAdd(key string, members ...string) (int64, error) {
+	res := s.c.SAdd(key, members...)
+	return res.Val(), res.Err()
+}
+
+func (s *redisStore) SRem(key string, members ...string) error {
+	return s.c.SRem(key, members...).Err()
+}
+
+func (s *redisStore) SMembers(key string) ([]string, error) {
+	res := s.c.SMembers(key)
+	return res.Val(), res.Err()
+}
+
+func (s *redisStore) SCard(key string) (int64, error) {
+	res := s.c.SCard(key)
+	return res.Val(), res.Err()
+}
+
+func (s *redisStore) SUnionStore(dest string, keys ...string) error {
+	return s.c.SUnionStore(dest, keys...).Err()
+}
+
+func (s *redisStore) ZAdd(key string, score float64, member string) error {
+	return s.c.ZAdd(key, r.Z{Score: score, Member: member}).Err()
+}
+
+func (s *redisStore) ZIncrBy(key string, incr float64, member string) (float64, error) {
+	res := s.c.ZIncrBy(key, incr, member)
+	return res.Val(), res.Err()
+}
+
+func (s *redisStore) ZRem(key string, members ...string) error {
+	return s.c.ZRem(key, members...).Err()
+}
+
+func (s *redisStore) ZCard(key string) (int64, error) {
+	res := s.c.ZCard(key)
+	return res.Val(), res.Err()
+}
+
+func (s *redisStore) ZRangeByScore(key, min, max string) ([]string, error) {
+	res := s.c.ZRangeByScore(key, min, max, 0, -1)
+	return res.Val(), res.Err()
+}
+
+func (s *redisStore) ZRevRangeWithScores(key string, start, stop int64) ([]Z, error) {
+	res := s.c.ZRevRangeWithScores(key, start, stop)
+	if err := res.Err(); err != nil {
+		return nil, err
+	}
+
+	// alternating member, score
+	raw := res.Val()
+	members := make([]Z, 0, len(raw)/2)
+	for i := 0; i+1 < len(raw); i += 2 {
+		score, _ := strconv.ParseFloat(raw[i+1], 64)
+		members = append(members, Z{Member: raw[i], Score: score})
+	}
+
+	return members, nil
+}
+
+func (s *redisStore) ZRevRank(key, member string) (int64, error) {
+	res := s.c.ZRevRank(key, member)
+	return res.Val(), redisErr(res.Err())
+}
+
+func (s *redisStore) Pipelined(fn func(b Batch)) error {
+	_, err := s.c.Pipelined(func(c *r.PipelineClient) {
+		fn(redisBatch{c})
+	})
+	return err
+}
+
+// Queues commands on a pipeline client
+type redisBatch struct {
+	c *r.PipelineClient
+}
+
+func (b redisBatch) Set(key, value string)              { b.c.Set(key, value) }
+func (b redisBatch) Del(keys ...string)                 { b.c.Del(keys...) }
+func (b redisBatch) HSet(key, field, value string)      { b.c.HSet(key, field, value) }
+func (b redisBatch) SAdd(key string, members ...string) { b.c.SAdd(key, members...) }
+func (b redisBatch) SRem(key string, members ...string) { b.c.SRem(key, members...) }
+func (b redisBatch) ZRem(key string, members ...string) { b.c.ZRem(key, members...) }
+func (b redisBatch) ZAdd(key string, score float64, member string) {
+	b.c.ZAdd(key, r.Z{Score: score, Member: member})
+}
+
+func (s *redisStore) Publish(channel, message string) error {
+	return s.c.Publish(channel, message).Err()
+}
+
+// Subscribers wait on a connection of their own, with no read timeout
+// as the channel may stay quiet for a long time. A dropped subscription
+// is made again, with a growing delay between attempts.
+func (s *redisStore) Subscribe(channel string) (<-chan string, error) {
+	cfg := s.cfg
+	cfg.ReadTimeout = 0
+	cfg.PoolSize = 0
+	c := NewRedis(cfg).(*redisStore).c
+
+	pubsub, msgs, err := subscribe(c, channel)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan string, 256)
+
+	go func() {
+		b := backoff{max: cfg.MaxBackoff}
+
+		for {
+			for msg := range msgs {
+				if msg.Err != nil {
+					err = msg.Err
+					break
+				}
+				if msg.Name == "message" {
+					out <- msg.Message
+					b = backoff{max: cfg.MaxBackoff}
+				}
+			}
+			pubsub.Close()
+
+			for {
+				wait := b.next()
+				fmt.Printf("[NOTICE]\tLost subscription to %v, retrying in %v. %v\n", channel, wait, err)
+				time.Sleep(wait)
+
+				if pubsub, msgs, err = subscribe(c, channel); err == nil {
+					break
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+func subscribe(c *r.Client, channel string) (*r.PubSubClient, chan *r.Message, error) {
+	pubsub, err := c.PubSubClient()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	msgs, err := pubsub.Subscribe(channel)
+	if err != nil {
+		pubsub.Close()
+		return nil, nil, err
+	}
+
+	return pubsub, msgs, nil
+}
+
+func (s *redisStore) Ping() error {
+	return s.c.Ping().Err()
+}
+
+func (s *redisStore) FlushDb() error {
+	return s.c.FlushDb().Err()
+}
+
+func (s *redisStore) Close() error {
+	return s.c.Close()
+}
@@ -0,0 +1,25 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDoublesUpToMax(t *testing.T) {
+	b := backoff{max: time.Second}
+
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+
+	for i, want := range expected {
+		if got := b.next(); got != want {
+			t.Errorf("Wait %v was %v, expected %v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Returned when a key (or member) doesn't exist
+var Nil = errors.New("db: nil")
+
+// Returned when a key holds a different kind of value
+var ErrWrongType = errors.New("db: operation against a key holding the wrong kind of value")
+
+// Member of a sorted set and its score
+type Z struct {
+	Member string
+	Score  float64
+}
+
+// Writes that can be queued in a pipeline
+type Batch interface {
+	Set(key, value string)
+	Del(keys ...string)
+	HSet(key, field, value string)
+	SAdd(key string, members ...string)
+	SRem(key string, members ...string)
+	ZAdd(key string, score float64, member string)
+	ZRem(key string, members ...string)
+}
+
+// Everything the server keeps between events. Redis backs it in
+// production; the in-memory version is handy for tests and running
+// without a redis-server.
+type Store interface {
+	// key/value
+	Get(key string) (string, error)
+	Set(key, value string) error
+	SetNX(key, value string) (bool, error)
+	Del(keys ...string) error
+	Keys(pattern string) ([]string, error)
+	// A page of the keys matching the pattern, and the cursor to pass
+	// for the next one; 0 once every key has been seen. Keys may turn
+	// up more than once.
+	Scan(cursor int64, pattern string, count int64) (next int64, keys []string, err error)
+
+	// counters
+	Incr(key string) (int64, error)
+	IncrBy(key string, n int64) (int64, error)
+
+	// hashes
+	HSet(key, field, value string) error
+	HGetAll(key string) (map[string]string, error)
+
+	// lists
+	LPush(key string, values ...string) error
+	LRange(key string, start, stop int64) ([]string, error)
+	LTrim(key string, start, stop int64) error
+
+	// sets
+	SAdd(key string, members ...string) (int64, error)
+	SRem(key string, members ...string) error
+	SMembers(key string) ([]string, error)
+	SCard(key string) (int64, error)
+	SUnionStore(dest string, keys ...string) error
+
+	// sorted sets
+	ZAdd(key string, score float64, member string) error
+	ZIncrBy(key string, incr float64, member string) (float64, error)
+	ZRem(key string, members ...string) error
+	ZCard(key string) (int64, error)
+	// members with min <= score <= max, lowest first; "-inf", "+inf" and
+	// a "(" prefix for exclusive bounds work as in redis
+	ZRangeByScore(key, min, max string) ([]string, error)
+	ZRevRangeWithScores(key string, start, stop int64) ([]Z, error)
+	ZRevRank(key, member string) (int64, error)
+
+	// Queue up writes and send them in one round trip. Results of the
+	// individual writes aren't available.
+	Pipelined(fn func(b Batch)) error
+
+	// pub/sub, for servers sharing the store
+	Publish(channel, message string) error
+	// Messages published on the channel from now on
+	Subscribe(channel string) (<-chan string, error)
+
+	// check the store is reachable
+	Ping() error
+	FlushDb() error
+	Close() error
+}
+
+// Read a number kept as a string, treating a missing key as 0
+func GetInt(key string) int {
+	val, _ := Client.Get(key)
+	n, _ := strconv.Atoi(val)
+	return n
+}
+
+// Hand out the id kept at the key and move it on, in one step so
+// concurrent callers never share an id
+func NextId(key string) (int, error) {
+	next, err := Client.Incr(key)
+	if err != nil {
+		return 0, err
+	}
+	return int(next - 1), nil
+}
+
+// Move the counter at the key up to at least n. Ids handed out in the
+// meantime are kept clear of; the counter never goes down.
+func RaiseTo(key string, n int) error {
+	current := GetInt(key)
+	if current >= n {
+		return nil
+	}
+	_, err := Client.IncrBy(key, int64(n-current))
+	return err
+}
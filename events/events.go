@@ -1,6 +1,7 @@
 package events
 
 import (
+	"bitbucket.org/jahfer/flux-middleman/client"
 	"bitbucket.org/jahfer/flux-middleman/packet"
 	"bitbucket.org/jahfer/flux-middleman/user"
 	"encoding/json"
@@ -20,6 +21,16 @@ type Manager struct {
 	Incoming chan packet.In
 	Outgoing chan packet.In
 	handlers map[string]eventHandlerFunc
+	// nil lets everything through
+	Limiter *Limiter
+	// when set, packets are handed over instead of handled here
+	Relay func(pkt packet.In)
+	calls chan func()
+}
+
+// Connection that can be dropped by the server
+type disconnecter interface {
+	Disconnect() error
 }
 
 func NewManager() Manager {
@@ -27,6 +38,7 @@ func NewManager() Manager {
 		Incoming: make(chan packet.In), 
 		Outgoing: make(chan packet.In), 
 		handlers: make(map[string]eventHandlerFunc),
+		calls: make(chan func()),
 	}
 }
 
@@ -37,42 +49,113 @@ func (em *Manager) HandleFunc(pattern string, handler eventHandlerFunc) {
 // execute stored callbacks for each event received
 func (em *Manager) Listener() {
 
-	for pkt := range em.Incoming {
-
-		// Dead packet; user has disconnected!
-		if pkt.Raw == nil {
-			// envoke disconnect callbacks
-			if callback, exists := em.handlers["user:disconnect"]; exists {
-				go callback(Event{ Name:"user:disconnect", Sender: pkt.Sender })
+	for {
+		select {
+		case f := <-em.calls:
+			f()
+		case pkt, ok := <-em.Incoming:
+			if !ok {
+				return
 			}
-			continue
+			em.handle(pkt)
 		}
+	}
+}
+
+// Run f on the listener, in turn with the events, e.g. to apply the
+// result of slow work done elsewhere. Handlers must not call it.
+func (em *Manager) Dispatch(f func()) {
+	em.calls <- f
+}
+
+func (em *Manager) handle(pkt packet.In) {
 
-		// unmarshal incoming packet
-		var e []Event
+	if em.Relay != nil {
+		em.Relay(pkt)
+		return
+	}
 
-		if err := packet.Unmarshal(pkt.Raw, &e); err != nil {
-			fmt.Printf("[NOTICE]\tCaught malformed message to server: %v\n", string(pkt.Raw))
-			continue
+	// Dead packet; user has disconnected!
+	if pkt.Raw == nil {
+		if em.Limiter != nil {
+			em.Limiter.Forget(pkt.Sender)
+		}
+		// envoke disconnect callbacks
+		if callback, exists := em.handlers["user:disconnect"]; exists {
+			go callback(Event{ Name:"user:disconnect", Sender: pkt.Sender })
 		}
-		evt := e[0]
-		evt.Sender = pkt.Sender
-
-		// envoke callback for event
-		if callback, exists := em.handlers[evt.Name]; exists {
-			response := callback(evt)
-			// reply back to client
-			if response != nil {
-				data, err := json.Marshal(response)
-				if err != nil {
-					panic(err.Error())
-				}
-				evt.Sender.Write(data)
+		return
+	}
+
+	// unmarshal incoming packet
+	var e []Event
+
+	if err := packet.Unmarshal(pkt.Raw, &e); err != nil {
+		fmt.Printf("[NOTICE]\tCaught malformed message to server: %v\n", string(pkt.Raw))
+		return
+	}
+	evt := e[0]
+	evt.Sender = pkt.Sender
+
+	if !em.allow(evt) {
+		return
+	}
+
+	// envoke callback for event
+	if callback, exists := em.handlers[evt.Name]; exists {
+		response := callback(evt)
+		// reply back to client
+		if response != nil {
+			data, err := json.Marshal(response)
+			if err != nil {
+				panic(err.Error())
 			}
+			evt.Sender.Write(data)
 		}
 	}
 }
 
+// check the sender hasn't gone over its rate limit for the event.
+// Displays are let through: XNA relays every player's shots over its
+// one connection.
+func (em *Manager) allow(evt Event) bool {
+	if em.Limiter == nil {
+		return true
+	}
+	if _, ok := evt.Sender.(*client.TcpClient); ok {
+		return true
+	}
+
+	ok, wait, warn, drop := em.Limiter.Allow(evt.Sender, evt.Name)
+	if ok {
+		return true
+	}
+
+	if drop {
+		fmt.Printf("[NOTICE]\tDisconnecting client flooding %v\n", evt.Name)
+		em.Limiter.Forget(evt.Sender)
+		if c, ok := evt.Sender.(disconnecter); ok {
+			c.Disconnect()
+		}
+		return false
+	}
+
+	if warn {
+		reply := packet.Out{
+			Name:    "error:rateLimit",
+			Message: Throttled{Event: evt.Name, RetryIn: wait.Seconds()},
+		}
+		// same encoding the hub uses for the client
+		if c, ok := evt.Sender.(client.Client); ok {
+			c.Write(c.Format(reply))
+		} else if data, err := json.Marshal(reply); err == nil {
+			evt.Sender.Write(data)
+		}
+	}
+
+	return false
+}
+
 // unmarshal an Event to strip just the user id information
 func GetUserId(e Event) user.Id {
 	defer func() {
@@ -0,0 +1,191 @@
+package events
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token bucket settings for one event: Rate tokens refill every second,
+// and up to Burst can be saved up
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Limits phones get out of the box
+var DefaultLimits = map[string]Limit{
+	"user:new":       {1, 3},
+	"user:touch":     {60, 120},
+	"user:touchEnd":  {10, 20},
+	"user:pinch":     {10, 20},
+	"user:pinchEnd":  {10, 20},
+	"user:bloat":     {10, 20},
+	"user:bloatEnd":  {10, 20},
+	"user:attack":    {5, 10},
+	"user:heartbeat": {2, 5},
+	// only XNA should send these, and displays aren't limited
+	"user:shoot": {5, 10},
+}
+
+// Reply sent when an event is dropped
+type Throttled struct {
+	Event   string  `json:"event" tcp:"event"`
+	RetryIn float64 `json:"retryIn" tcp:"retryIn"`
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// already told the client about this bucket running dry
+	warned bool
+}
+
+type offender struct {
+	strikes int
+	since   time.Time
+}
+
+// Per-connection, per-event rate limiting. Connections that keep going
+// past their limits are flagged to be dropped.
+type Limiter struct {
+	// Dropped events allowed within Window before hanging up
+	MaxStrikes int
+	Window     time.Duration
+
+	mutex     sync.Mutex
+	limits    map[string]Limit
+	buckets   map[io.Writer]map[string]*bucket
+	offenders map[io.Writer]*offender
+}
+
+func NewLimiter(limits map[string]Limit) *Limiter {
+	l := &Limiter{
+		MaxStrikes: 100,
+		Window:     10 * time.Second,
+		limits:     make(map[string]Limit),
+		buckets:    make(map[io.Writer]map[string]*bucket),
+		offenders:  make(map[io.Writer]*offender),
+	}
+
+	for name, limit := range limits {
+		l.limits[name] = limit
+	}
+
+	return l
+}
+
+// Change (or add) the limit for an event
+func (l *Limiter) Set(name string, limit Limit) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.limits[name] = limit
+}
+
+// Take a token for the event. Returns whether the event may go through,
+// how long until it would, whether the client should be told and
+// whether the connection has flooded long enough to be dropped.
+func (l *Limiter) Allow(sender io.Writer, name string) (ok bool, wait time.Duration, warn, drop bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	limit, limited := l.limits[name]
+	if !limited {
+		return true, 0, false, false
+	}
+
+	now := time.Now()
+
+	buckets, exists := l.buckets[sender]
+	if !exists {
+		buckets = make(map[string]*bucket)
+		l.buckets[sender] = buckets
+	}
+
+	b, exists := buckets[name]
+	if !exists {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		buckets[name] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * limit.Rate
+	if b.tokens > float64(limit.Burst) {
+		b.tokens = float64(limit.Burst)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.warned = false
+		return true, 0, false, false
+	}
+
+	if limit.Rate > 0 {
+		wait = time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	}
+
+	warn = !b.warned
+	b.warned = true
+
+	o, exists := l.offenders[sender]
+	if !exists || now.Sub(o.since) > l.Window {
+		o = &offender{since: now}
+		l.offenders[sender] = o
+	}
+	o.strikes++
+
+	drop = l.MaxStrikes > 0 && o.strikes >= l.MaxStrikes
+
+	return false, wait, warn, drop
+}
+
+// Throw away everything known about a connection
+func (l *Limiter) Forget(sender io.Writer) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	delete(l.buckets, sender)
+	delete(l.offenders, sender)
+}
+
+// Parse limits in the form "user:touch=60/120,user:attack=5/10",
+// where each value is rate per second / burst
+func ParseLimits(s string) (map[string]Limit, error) {
+	limits := make(map[string]Limit)
+
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("Invalid rate limit: " + entry)
+		}
+
+		values := strings.SplitN(parts[1], "/", 2)
+		rate, err := strconv.ParseFloat(values[0], 64)
+		if err != nil {
+			return nil, errors.New("Invalid rate limit: " + entry)
+		}
+
+		burst := int(rate)
+		if len(values) == 2 {
+			if burst, err = strconv.Atoi(values[1]); err != nil {
+				return nil, errors.New("Invalid rate limit: " + entry)
+			}
+		}
+		if burst < 1 {
+			burst = 1
+		}
+
+		limits[parts[0]] = Limit{rate, burst}
+	}
+
+	return limits, nil
+}
@@ -0,0 +1,90 @@
+package events
+
+import (
+	"bitbucket.org/jahfer/flux-middleman/client"
+	"bytes"
+	"testing"
+)
+
+func TestLimiterAllowsBurstThenThrottles(t *testing.T) {
+	l := NewLimiter(map[string]Limit{"user:attack": {0, 3}})
+	sender := &bytes.Buffer{}
+
+	for i := 0; i < 3; i++ {
+		if ok, _, _, _ := l.Allow(sender, "user:attack"); !ok {
+			t.Fatalf("Event %v was throttled within the burst", i)
+		}
+	}
+
+	ok, _, warn, _ := l.Allow(sender, "user:attack")
+	if ok || !warn {
+		t.Errorf("Expected first throttled event to warn, got ok=%v warn=%v", ok, warn)
+	}
+
+	if _, _, warn, _ := l.Allow(sender, "user:attack"); warn {
+		t.Errorf("Client was warned twice for the same bucket")
+	}
+
+	if ok, _, _, _ := l.Allow(sender, "user:touch"); !ok {
+		t.Errorf("Unlimited event was throttled")
+	}
+}
+
+func TestLimiterDropsFlooders(t *testing.T) {
+	l := NewLimiter(map[string]Limit{"user:touch": {0, 1}})
+	l.MaxStrikes = 5
+	sender := &bytes.Buffer{}
+
+	l.Allow(sender, "user:touch")
+	for i := 1; i < l.MaxStrikes; i++ {
+		if _, _, _, drop := l.Allow(sender, "user:touch"); drop {
+			t.Fatalf("Dropped after only %v strikes", i)
+		}
+	}
+
+	if _, _, _, drop := l.Allow(sender, "user:touch"); !drop {
+		t.Errorf("Flooding client was not dropped")
+	}
+
+	l.Forget(sender)
+	if ok, _, _, _ := l.Allow(sender, "user:touch"); !ok {
+		t.Errorf("Forgotten client is still throttled")
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	limits, err := ParseLimits("user:touch=60/120, user:attack=5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l := limits["user:touch"]; l.Rate != 60 || l.Burst != 120 {
+		t.Errorf("Got %+v for user:touch", l)
+	}
+	if l := limits["user:attack"]; l.Rate != 5 || l.Burst != 5 {
+		t.Errorf("Got %+v for user:attack", l)
+	}
+
+	if _, err := ParseLimits("user:touch"); err == nil {
+		t.Errorf("Expected an error for a limit without a rate")
+	}
+}
+
+func TestDisplaysAreNotLimited(t *testing.T) {
+	em := NewManager()
+	em.Limiter = NewLimiter(map[string]Limit{"user:shoot": {0, 1}})
+	em.Limiter.MaxStrikes = 1
+
+	display := &client.TcpClient{}
+	for i := 0; i < 10; i++ {
+		if !em.allow(Event{Name: "user:shoot", Sender: display}) {
+			t.Fatalf("Display's shot %v was dropped", i)
+		}
+	}
+
+	phone := &bytes.Buffer{}
+	em.allow(Event{Name: "user:shoot", Sender: phone})
+	if em.allow(Event{Name: "user:shoot", Sender: phone}) {
+		t.Errorf("Phone was let past its limit")
+	}
+}
@@ -0,0 +1,283 @@
+package game
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+type State int
+
+const (
+	Lobby State = iota
+	Countdown
+	Running
+	Paused
+	Ended
+)
+
+// Returned by every action once the session has been stopped
+var ErrStopped = errors.New("Game has been stopped")
+
+var stateNames = []string{"lobby", "countdown", "running", "paused", "ended"}
+
+func (s State) String() string {
+	if int(s) < len(stateNames) {
+		return stateNames[s]
+	}
+	return "unknown"
+}
+
+// What gets sent out to XNA and the phones on every transition
+type Status struct {
+	State     string `json:"state" tcp:"state"`
+	Remaining int    `json:"remaining" tcp:"remaining"`
+}
+
+type change struct {
+	from, to State
+	status   Status
+}
+
+// A single round, from lobby through to the final whistle
+type Session struct {
+	RoundLength     time.Duration
+	CountdownLength time.Duration
+	// called after every transition, with the status as of that
+	// transition
+	OnChange func(from, to State, status Status)
+
+	mutex sync.Mutex
+	// transitions waiting to be delivered, and a nudge for notify
+	pending   []change
+	wake      chan bool
+	state     State
+	endsAt    time.Time
+	remaining time.Duration
+	timer     *time.Timer
+	stopped   bool
+}
+
+func NewSession(round, countdown time.Duration) *Session {
+	s := &Session{
+		RoundLength:     round,
+		CountdownLength: countdown,
+		wake:            make(chan bool, 1),
+		state:           Lobby,
+	}
+
+	go s.notify()
+
+	return s
+}
+
+// Deliver transitions in order, without holding the lock, so OnChange
+// is free to call back into the session
+func (s *Session) notify() {
+	for _ = range s.wake {
+		s.mutex.Lock()
+		batch := s.pending
+		s.pending = nil
+		s.mutex.Unlock()
+
+		for _, c := range batch {
+			if s.OnChange != nil {
+				s.OnChange(c.from, c.to, c.status)
+			}
+		}
+	}
+}
+
+func (s *Session) State() State {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.state
+}
+
+func (s *Session) IsRunning() bool {
+	return s.State() == Running
+}
+
+func (s *Session) Status() Status {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.status()
+}
+
+// must be called with the mutex held
+func (s *Session) status() Status {
+	var left time.Duration
+	switch s.state {
+	case Countdown, Running:
+		left = s.endsAt.Sub(time.Now())
+	case Paused:
+		left = s.remaining
+	}
+
+	if left < 0 {
+		left = 0
+	}
+
+	return Status{s.state.String(), int(left.Seconds())}
+}
+
+// Leave the lobby and begin counting down to the round
+func (s *Session) Start() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stopped {
+		return ErrStopped
+	}
+	if s.state != Lobby {
+		return s.invalid("start")
+	}
+
+	if s.CountdownLength <= 0 {
+		s.run(s.RoundLength)
+		return nil
+	}
+
+	s.transition(Countdown, s.CountdownLength, func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		if s.state == Countdown {
+			s.run(s.RoundLength)
+		}
+	})
+
+	return nil
+}
+
+func (s *Session) Pause() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stopped {
+		return ErrStopped
+	}
+	if s.state != Running {
+		return s.invalid("pause")
+	}
+
+	s.remaining = s.endsAt.Sub(time.Now())
+	s.transition(Paused, 0, nil)
+
+	return nil
+}
+
+func (s *Session) Resume() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stopped {
+		return ErrStopped
+	}
+	if s.state != Paused {
+		return s.invalid("resume")
+	}
+
+	s.run(s.remaining)
+
+	return nil
+}
+
+// Finish the round early
+func (s *Session) End() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stopped {
+		return ErrStopped
+	}
+	if s.state != Running && s.state != Paused {
+		return s.invalid("end")
+	}
+
+	s.transition(Ended, 0, nil)
+
+	return nil
+}
+
+// Head back to the lobby for another round
+func (s *Session) Reset() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stopped {
+		return ErrStopped
+	}
+	if s.state == Lobby {
+		return s.invalid("reset")
+	}
+
+	s.transition(Lobby, 0, nil)
+
+	return nil
+}
+
+// Stop the clock and the delivery of changes for good, e.g. once the
+// room is closed
+func (s *Session) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stopped {
+		return
+	}
+	s.stopped = true
+	s.pending = nil
+
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	close(s.wake)
+}
+
+func (s *Session) run(length time.Duration) {
+	s.transition(Running, length, func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		if s.state == Running {
+			s.transition(Ended, 0, nil)
+		}
+	})
+}
+
+// must be called with the mutex held
+func (s *Session) transition(to State, length time.Duration, expire func()) {
+	// a timer may have fired just before the session was stopped
+	if s.stopped {
+		return
+	}
+
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+
+	from := s.state
+	s.state = to
+
+	if expire != nil {
+		s.endsAt = time.Now().Add(length)
+		s.timer = time.AfterFunc(length, expire)
+	}
+
+	s.pending = append(s.pending, change{from, to, s.status()})
+
+	// notify may already be on its way
+	select {
+	case s.wake <- true:
+	default:
+	}
+}
+
+func (s *Session) invalid(action string) error {
+	return errors.New("Cannot " + action + " while game is " + s.state.String())
+}
@@ -0,0 +1,99 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionLifecycle(t *testing.T) {
+	s := NewSession(50*time.Millisecond, 10*time.Millisecond)
+
+	changes := make(chan State, 10)
+	s.OnChange = func(from, to State, _ Status) { changes <- to }
+
+	if err := s.Pause(); err == nil {
+		t.Errorf("Paused from the lobby")
+	}
+
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []State{Countdown, Running}
+	for _, state := range expect {
+		if got := <-changes; got != state {
+			t.Fatalf("Expected %v, got %v", state, got)
+		}
+	}
+
+	if err := s.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	<-changes
+
+	if err := s.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	<-changes
+
+	select {
+	case got := <-changes:
+		if got != Ended {
+			t.Errorf("Expected round to end, got %v", got)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Round never ended")
+	}
+
+	if err := s.Reset(); err != nil || s.State() != Lobby {
+		t.Errorf("Could not return to lobby: %v", err)
+	}
+}
+
+func TestStoppedSessionStaysQuiet(t *testing.T) {
+	s := NewSession(10*time.Millisecond, 0)
+
+	changes := make(chan State, 10)
+	s.OnChange = func(from, to State, _ Status) { changes <- to }
+
+	s.Start()
+	<-changes
+	s.Stop()
+	s.Stop()
+
+	// the round's timer would have ended it by now
+	select {
+	case got := <-changes:
+		t.Errorf("Got %v after stopping", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := s.Pause(); err != ErrStopped {
+		t.Errorf("Stopped session took a pause: %v", err)
+	}
+}
+
+func TestChangesCanCallBack(t *testing.T) {
+	s := NewSession(time.Minute, 0)
+
+	delivered := make(chan Status, 100)
+	s.OnChange = func(from, to State, status Status) {
+		// used to deadlock once the queue of changes filled up
+		s.Status()
+		delivered <- status
+	}
+
+	s.Start()
+	for i := 0; i < 20; i++ {
+		s.Pause()
+		s.Resume()
+	}
+
+	for i := 0; i < 41; i++ {
+		select {
+		case <-delivered:
+		case <-time.After(time.Second):
+			t.Fatalf("Only %v of 41 changes delivered", i)
+		}
+	}
+}
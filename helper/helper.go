@@ -1,41 +1,54 @@
 package helper
 
 import (
-	"bitbucket.org/jahfer/flux-middleman/network"
+	"bitbucket.org/jahfer/flux-middleman/badges"
 	"bitbucket.org/jahfer/flux-middleman/db"
-	"fmt"
+	"bitbucket.org/jahfer/flux-middleman/ledger"
+	"bitbucket.org/jahfer/flux-middleman/packet"
+	"strconv"
+	"time"
 )
 
-func SendBadge(badge string, userId int) {
+func SendBadge(s Scope, badge string, userId int) {
 	msg := struct {
 		Name string `tcp:"name"`
 		Badge string `tcp:"type"`
 		Id   int    `tcp:"id"`
 	}{"user:getBadge", badge, userId}
 
-	badgeKey := fmt.Sprintf("uid:%v:badges", userId)
-	res := db.Redis.SAdd(badgeKey, badge)
+	added, _ := db.Client.SAdd(s.Keys.User(userId).Badges(), badge)
 
-	if res.Val() != 0 {
-		network.TcpClients.Broadcast <- msg
+	if added != 0 {
+		// remember when it was earned
+		earned := time.Now().Unix()
+		db.Client.HSet(s.Keys.User(userId).BadgeTimes(), badge, strconv.FormatInt(earned, 10))
+
+		s.BroadcastXna(msg)
+
+		b, _ := badges.Get(badge)
+		s.ToPhone(userId, packet.Out{Name: "user:getBadge", Message: badges.Earned{Badge: b, Earned: earned}})
 	}
 }
 
-func SendPoints(amount, userId int) {
+func SendPoints(s Scope, amount, userId int) {
 	msg := struct {
 		Name 	string `tcp:"name"`
 		Value 	int `tcp:"value"`
 		Id   	int    `tcp:"id"`
 	}{"user:getPoints", amount, userId}
 
-	network.TcpClients.Broadcast <- msg
+	s.BroadcastXna(msg)
+
+	// phone shows the running total
+	total := ledger.Total(s.Keys, userId)
+	s.ToPhone(userId, packet.Out{Name: "user:getPoints", Message: total})
 }
 
-func ToXna(evt string, id int) {
+func ToXna(s Scope, evt string, id int) {
 	msg := struct {
 		Name string `tcp:"name"`
 		Id   int    `tcp:"id"`
 	}{evt, id}
 
-	network.TcpClients.Broadcast <- msg
+	s.BroadcastXna(msg)
 }
\ No newline at end of file
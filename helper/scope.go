@@ -0,0 +1,70 @@
+package helper
+
+import (
+	"bitbucket.org/jahfer/flux-middleman/client"
+	"bitbucket.org/jahfer/flux-middleman/cluster"
+	"bitbucket.org/jahfer/flux-middleman/keys"
+	"bitbucket.org/jahfer/flux-middleman/network"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Finds the phone a player is using
+type Roster interface {
+	Conn(userId int) (io.Writer, bool)
+}
+
+// A room's share of the server: its key namespace, plus the phones
+// and XNA displays that have joined it
+type Scope struct {
+	Room   string
+	Keys   keys.Room
+	Roster Roster
+}
+
+func NewScope(room string) Scope {
+	return Scope{Room: room, Keys: keys.ForRoom(room)}
+}
+
+// Send straight to one player's phone
+func (s Scope) ToPhone(userId int, msg interface{}) {
+	if s.Roster == nil {
+		return
+	}
+
+	conn, ok := s.Roster.Conn(userId)
+	if !ok {
+		return
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		fmt.Printf("[ERROR]\tCould not encode message for user %v. %v\n", userId, err)
+		return
+	}
+
+	conn.Write(data)
+}
+
+// Send to every XNA display attached to the room
+func (s Scope) BroadcastXna(msg interface{}) {
+	network.TcpClients.Broadcast <- client.Envelope{Room: s.Room, Message: msg}
+}
+
+// Send to every phone in the room
+func (s Scope) BroadcastPhones(msg interface{}) {
+	network.WsClients.Broadcast <- client.Envelope{Room: s.Room, Message: msg}
+	cluster.Broadcast(s.Room, msg)
+}
+
+// Send to everybody watching the room without playing
+func (s Scope) BroadcastSpectators(msg interface{}) {
+	network.WsClients.Broadcast <- client.Envelope{Room: SpectatorChannel(s.Room), Message: msg}
+	cluster.Broadcast(SpectatorChannel(s.Room), msg)
+}
+
+// Hub channel spectators of a room listen on
+func SpectatorChannel(room string) string {
+	return room + "#spectators"
+}
@@ -0,0 +1,107 @@
+package input
+
+import (
+	"bitbucket.org/jahfer/flux-middleman/user"
+	"sync"
+	"time"
+)
+
+// Collects touches between ticks so only each player's latest
+// position goes out to the display
+type Aggregator struct {
+	// called for every position that's sent on
+	Flush func(pos user.Coords)
+
+	mutex   sync.Mutex
+	pending map[int]user.Coords
+	// user ids in the order they first touched since the last tick
+	order []int
+	// keeps a user's touch from racing past their touchEnd
+	sending sync.Mutex
+	quit    chan bool
+	stop    sync.Once
+}
+
+func NewAggregator(flush func(pos user.Coords)) *Aggregator {
+	return &Aggregator{
+		Flush:   flush,
+		pending: make(map[int]user.Coords),
+		quit:    make(chan bool),
+	}
+}
+
+// Hold on to a touch until the next tick, replacing any older one
+func (a *Aggregator) Push(pos user.Coords) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if _, waiting := a.pending[pos.Id]; !waiting {
+		a.order = append(a.order, pos.Id)
+	}
+	a.pending[pos.Id] = pos
+}
+
+// Send the user's waiting touch right away, e.g. before their touchEnd
+func (a *Aggregator) FlushUser(userId int) {
+	a.sending.Lock()
+	defer a.sending.Unlock()
+
+	a.mutex.Lock()
+	pos, waiting := a.pending[userId]
+	if waiting {
+		delete(a.pending, userId)
+		for i, id := range a.order {
+			if id == userId {
+				a.order = append(a.order[:i], a.order[i+1:]...)
+				break
+			}
+		}
+	}
+	a.mutex.Unlock()
+
+	if waiting {
+		a.Flush(pos)
+	}
+}
+
+// Send every waiting touch
+func (a *Aggregator) FlushAll() {
+	a.sending.Lock()
+	defer a.sending.Unlock()
+
+	a.mutex.Lock()
+	batch := make([]user.Coords, 0, len(a.order))
+	for _, id := range a.order {
+		batch = append(batch, a.pending[id])
+	}
+	a.pending = make(map[int]user.Coords)
+	a.order = a.order[:0]
+	a.mutex.Unlock()
+
+	for _, pos := range batch {
+		a.Flush(pos)
+	}
+}
+
+// Flush at the given ticks per second until stopped
+func (a *Aggregator) Run(rate int) {
+	ticker := time.NewTicker(time.Second / time.Duration(rate))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.FlushAll()
+		case <-a.quit:
+			a.FlushAll()
+			return
+		}
+	}
+}
+
+// Stop flushing; safe to call more than once
+func (a *Aggregator) Stop() {
+	a.stop.Do(func() {
+		close(a.quit)
+	})
+}
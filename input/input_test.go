@@ -0,0 +1,61 @@
+package input
+
+import (
+	"bitbucket.org/jahfer/flux-middleman/user"
+	"reflect"
+	"testing"
+)
+
+func TestAggregatorKeepsLatestPosition(t *testing.T) {
+	var sent []user.Coords
+	a := NewAggregator(func(pos user.Coords) { sent = append(sent, pos) })
+
+	a.Push(user.Coords{Id: 1, X: 1, Y: 1})
+	a.Push(user.Coords{Id: 2, X: 5, Y: 5})
+	a.Push(user.Coords{Id: 1, X: 2, Y: 2})
+	a.FlushAll()
+
+	expected := []user.Coords{{Id: 1, X: 2, Y: 2}, {Id: 2, X: 5, Y: 5}}
+	if !reflect.DeepEqual(sent, expected) {
+		t.Errorf("Got %v, expected %v", sent, expected)
+	}
+
+	sent = nil
+	a.FlushAll()
+	if len(sent) != 0 {
+		t.Errorf("Touches were sent twice: %v", sent)
+	}
+}
+
+func TestAggregatorFlushUser(t *testing.T) {
+	var sent []user.Coords
+	a := NewAggregator(func(pos user.Coords) { sent = append(sent, pos) })
+
+	a.Push(user.Coords{Id: 1, X: 1, Y: 1})
+	a.Push(user.Coords{Id: 2, X: 5, Y: 5})
+	a.FlushUser(1)
+
+	if expected := []user.Coords{{Id: 1, X: 1, Y: 1}}; !reflect.DeepEqual(sent, expected) {
+		t.Errorf("Got %v, expected %v", sent, expected)
+	}
+
+	sent = nil
+	a.FlushAll()
+	if expected := []user.Coords{{Id: 2, X: 5, Y: 5}}; !reflect.DeepEqual(sent, expected) {
+		t.Errorf("Got %v, expected %v", sent, expected)
+	}
+}
+
+func TestAggregatorStopTwice(t *testing.T) {
+	a := NewAggregator(func(pos user.Coords) {})
+
+	done := make(chan bool)
+	go func() {
+		a.Run(30)
+		done <- true
+	}()
+
+	a.Stop()
+	a.Stop()
+	<-done
+}
@@ -0,0 +1,102 @@
+package input
+
+import (
+	"bitbucket.org/jahfer/flux-middleman/user"
+	"io"
+	"math"
+	"sync"
+)
+
+// Moves touches from each phone's own screen onto each display: into a
+// shared space running from 0 to 1 on both axes, and out to the
+// display's pixels for displays that asked for them
+type Mapper struct {
+	mutex     sync.Mutex
+	viewports map[int]user.Viewport
+	// display connection -> its resolution
+	displays map[io.Writer]user.Viewport
+}
+
+func NewMapper() *Mapper {
+	return &Mapper{
+		viewports: make(map[int]user.Viewport),
+		displays:  make(map[io.Writer]user.Viewport),
+	}
+}
+
+// Remember the size of the user's screen
+func (m *Mapper) SetViewport(userId int, v user.Viewport) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if v.Width <= 0 || v.Height <= 0 {
+		delete(m.viewports, userId)
+		return
+	}
+	m.viewports[userId] = v
+}
+
+// Forget the user's screen, e.g. once they've left
+func (m *Mapper) ForgetViewport(userId int) {
+	m.SetViewport(userId, user.Viewport{})
+}
+
+// Resolution touches sent to the display are scaled to; zero goes back
+// to sending them from 0 to 1
+func (m *Mapper) SetDisplay(display io.Writer, v user.Viewport) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if v.Width <= 0 || v.Height <= 0 {
+		delete(m.displays, display)
+		return
+	}
+	m.displays[display] = v
+}
+
+// Forget the display's resolution, handing it back if it had sent one,
+// e.g. to carry it over to another room
+func (m *Mapper) TakeDisplay(display io.Writer) (v user.Viewport, ok bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	v, ok = m.displays[display]
+	delete(m.displays, display)
+	return
+}
+
+// Where the touch lands on the display. ok is false for phones that
+// never sent their viewport, as there's no telling where on their
+// screen the touch was.
+func (m *Mapper) Map(pos user.Coords, display io.Writer) (user.Coords, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	v, ok := m.viewports[pos.Id]
+	if !ok {
+		return pos, false
+	}
+
+	pos.X = clamp(pos.X / v.Width)
+	pos.Y = clamp(pos.Y / v.Height)
+
+	if d, ok := m.displays[display]; ok {
+		pos.X = round(pos.X*d.Width, 2)
+		pos.Y = round(pos.Y*d.Height, 2)
+	} else {
+		pos.X = round(pos.X, 4)
+		pos.Y = round(pos.Y, 4)
+	}
+
+	return pos, true
+}
+
+func clamp(f float64) float64 {
+	return math.Max(0, math.Min(1, f))
+}
+
+// keeps the TCP format free of long fractions
+func round(f float64, places int) float64 {
+	shift := math.Pow(10, float64(places))
+	return math.Floor(f*shift+0.5) / shift
+}
@@ -0,0 +1,51 @@
+package input
+
+import (
+	"bitbucket.org/jahfer/flux-middleman/user"
+	"bytes"
+	"testing"
+)
+
+func TestMapperNormalizesByDefault(t *testing.T) {
+	m := NewMapper()
+	m.SetViewport(1, user.Viewport{Width: 320, Height: 480})
+	display := &bytes.Buffer{}
+
+	pos, ok := m.Map(user.Coords{Id: 1, X: 160, Y: 600}, display)
+	if !ok || pos.X != 0.5 || pos.Y != 1 {
+		t.Errorf("Got %v, expected 0.5, 1", pos)
+	}
+
+	if pos, ok := m.Map(user.Coords{Id: 2, X: 160, Y: 600}, display); ok {
+		t.Errorf("Touch without a viewport was mapped to %v", pos)
+	}
+}
+
+func TestMapperScalesToEachDisplay(t *testing.T) {
+	m := NewMapper()
+	m.SetViewport(1, user.Viewport{Width: 320, Height: 480})
+
+	big, small := &bytes.Buffer{}, &bytes.Buffer{}
+	m.SetDisplay(big, user.Viewport{Width: 1920, Height: 1080})
+	m.SetDisplay(small, user.Viewport{Width: 800, Height: 600})
+
+	touch := user.Coords{Id: 1, X: 80, Y: 160}
+	if pos, _ := m.Map(touch, big); pos.X != 480 || pos.Y != 360 {
+		t.Errorf("Got %v on the big display, expected 480, 360", pos)
+	}
+	if pos, _ := m.Map(touch, small); pos.X != 200 || pos.Y != 200 {
+		t.Errorf("Got %v on the small display, expected 200, 200", pos)
+	}
+
+	if v, ok := m.TakeDisplay(big); !ok || v.Width != 1920 {
+		t.Errorf("Took back %v", v)
+	}
+	if pos, _ := m.Map(touch, big); pos.X != 0.25 || pos.Y != 0.3333 {
+		t.Errorf("Forgotten display still scaled to %v", pos)
+	}
+
+	m.ForgetViewport(1)
+	if pos, ok := m.Map(touch, small); ok {
+		t.Errorf("Forgotten phone's touch was mapped to %v", pos)
+	}
+}
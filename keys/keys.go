@@ -0,0 +1,132 @@
+package keys
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Put in front of every key, so several servers can share a database
+var Prefix = ""
+
+// Last part of the key each room's snapshot is saved under
+const snapshot = "global:snapshot"
+
+// Keys belonging to one room. The default room ("") keeps the bare key
+// names; others live under "room:CODE:".
+type Room struct {
+	ns string
+}
+
+func ForRoom(code string) Room {
+	if code == "" {
+		return Room{Prefix}
+	}
+	return Room{Prefix + "room:" + code + ":"}
+}
+
+// Recover the room code from one of its keys
+func RoomFromKey(key string) string {
+	key = strings.TrimPrefix(key, Prefix)
+	if !strings.HasPrefix(key, "room:") {
+		return ""
+	}
+	parts := strings.SplitN(key, ":", 3)
+	return parts[1]
+}
+
+// Pattern matching every room's snapshot
+func Snapshots() string {
+	return Prefix + "*" + snapshot
+}
+
+// Patterns covering every key the server writes, in every room
+func Owned() []string {
+	if Prefix != "" {
+		return []string{Prefix + "*"}
+	}
+	return []string{"global:*", "uid:*", "team:*", "username:*", "leaderboard:*", "room:*"}
+}
+
+// Namespace every key of the room starts with
+func (r Room) Namespace() string {
+	return r.ns
+}
+
+// Pattern matching every key of the room; for rooms other than the
+// default one, whose keys are mixed in with the rest
+func (r Room) Pattern() string {
+	return r.ns + "*"
+}
+
+func (r Room) NextUserId() string {
+	return r.ns + "global:nextUserId"
+}
+
+func (r Room) NextTeamId() string {
+	return r.ns + "global:nextTeamId"
+}
+
+// Sorted set of user ids scored by their last heartbeat
+func (r Room) Clients() string {
+	return r.ns + "global:clients"
+}
+
+func (r Room) Snapshot() string {
+	return r.ns + snapshot
+}
+
+// Id of the player going by the name. The big screen shows names in
+// capitals, so JOE and joe share a key.
+func (r Room) Username(name string) string {
+	return r.ns + "username:" + strings.ToUpper(name) + ":uid"
+}
+
+func (r Room) Leaderboard(board string) string {
+	return r.ns + "leaderboard:" + board
+}
+
+func (r Room) User(id int) User {
+	return User{r.ns + "uid:" + strconv.Itoa(id) + ":"}
+}
+
+func (r Room) Team(id int) Team {
+	return Team{r.ns + "team:" + strconv.Itoa(id) + ":"}
+}
+
+// Keys belonging to one player
+type User struct {
+	base string
+}
+
+func (u User) Points() string     { return u.base + "points" }
+func (u User) Ledger() string     { return u.base + "ledger" }
+func (u User) Team() string       { return u.base + "team" }
+func (u User) Badges() string     { return u.base + "badges" }
+func (u User) BadgeTimes() string { return u.base + "badgeTimes" }
+func (u User) Username() string   { return u.base + "username" }
+
+// Every key the player can own
+func (u User) All() []string {
+	return []string{u.Points(), u.Ledger(), u.Team(), u.Badges(), u.BadgeTimes(), u.Username()}
+}
+
+// Keys belonging to one team and its collector
+type Team struct {
+	base string
+}
+
+func (t Team) Users() string    { return t.base + "users" }
+func (t Team) Health() string   { return t.base + "health" }
+func (t Team) Fill() string     { return t.base + "fill" }
+func (t Team) Capacity() string { return t.base + "capacity" }
+func (t Team) Color() string    { return t.base + "color" }
+
+// Every key the team can own
+func (t Team) All() []string {
+	return []string{t.Users(), t.Health(), t.Fill(), t.Capacity(), t.Color()}
+}
+
+// Pub/sub channel servers in a cluster talk over
+func Channel(name string) string {
+	return Prefix + "cluster:" + name
+}
@@ -0,0 +1,40 @@
+package keys
+
+import (
+	"testing"
+)
+
+func TestRoomNamespaces(t *testing.T) {
+	if key := ForRoom("").User(3).Points(); key != "uid:3:points" {
+		t.Errorf("Default room key is %v", key)
+	}
+	if key := ForRoom("ABCD").Team(1).Users(); key != "room:ABCD:team:1:users" {
+		t.Errorf("Room key is %v", key)
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	Prefix = "flux:"
+	defer func() { Prefix = "" }()
+
+	key := ForRoom("ABCD").Snapshot()
+	if key != "flux:room:ABCD:global:snapshot" {
+		t.Errorf("Prefixed key is %v", key)
+	}
+	if code := RoomFromKey(key); code != "ABCD" {
+		t.Errorf("Got room %q back from %v", code, key)
+	}
+	if code := RoomFromKey(ForRoom("").Snapshot()); code != "" {
+		t.Errorf("Got room %q back for the default room", code)
+	}
+}
+
+func TestUserKeysAreDistinct(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, key := range ForRoom("").User(7).All() {
+		if seen[key] {
+			t.Errorf("%v listed twice", key)
+		}
+		seen[key] = true
+	}
+}
@@ -0,0 +1,114 @@
+package leaderboard
+
+import (
+	"bitbucket.org/jahfer/flux-middleman/db"
+	"bitbucket.org/jahfer/flux-middleman/keys"
+	"fmt"
+	"strconv"
+)
+
+// Boards kept for every room
+const (
+	Users = "users"
+	Teams = "teams"
+)
+
+type Entry struct {
+	Rank   int    `json:"rank"`
+	Id     int    `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Points int    `json:"points"`
+}
+
+func IsBoard(board string) bool {
+	return board == Users || board == Teams
+}
+
+// Credit a player on the individual board
+func AddPoints(k keys.Room, userId, amount int) {
+	db.Client.ZIncrBy(k.Leaderboard(Users), float64(amount), strconv.Itoa(userId))
+}
+
+// Put a player on the board with a known total, e.g. after a restore
+func SetUser(k keys.Room, userId, points int) {
+	db.Client.ZAdd(k.Leaderboard(Users), float64(points), strconv.Itoa(userId))
+}
+
+func RemoveUser(k keys.Room, userId int) {
+	db.Client.ZRem(k.Leaderboard(Users), strconv.Itoa(userId))
+}
+
+// Replace the team board with the given team totals, in one round
+// trip so readers don't catch it half built
+func SetTeams(k keys.Room, totals map[int]int) {
+	teamsKey := k.Leaderboard(Teams)
+
+	err := db.Client.Pipelined(func(b db.Batch) {
+		b.Del(teamsKey)
+		for teamId, points := range totals {
+			b.ZAdd(teamsKey, float64(points), strconv.Itoa(teamId))
+		}
+	})
+
+	if err != nil {
+		fmt.Printf("[ERROR]\tCould not update the team leaderboard. %v\n", err)
+	}
+}
+
+func RemoveTeam(k keys.Room, teamId int) {
+	db.Client.ZRem(k.Leaderboard(Teams), strconv.Itoa(teamId))
+}
+
+// Empty both boards, e.g. for a new round
+func Clear(k keys.Room) {
+	db.Client.Del(k.Leaderboard(Users), k.Leaderboard(Teams))
+}
+
+func Size(k keys.Room, board string) int {
+	size, _ := db.Client.ZCard(k.Leaderboard(board))
+	return int(size)
+}
+
+// A page of the board, best first
+func Top(k keys.Room, board string, offset, count int) []Entry {
+	if offset < 0 {
+		offset = 0
+	}
+	if count < 1 {
+		return nil
+	}
+
+	return page(k, board, offset, count)
+}
+
+// Count entries centred on the given player or team
+func Around(k keys.Room, board string, id, count int) ([]Entry, error) {
+	rank, err := db.Client.ZRevRank(k.Leaderboard(board), strconv.Itoa(id))
+	if err != nil {
+		return nil, fmt.Errorf("%v not on the %v board", id, board)
+	}
+
+	start := int(rank) - count/2
+	if start < 0 {
+		start = 0
+	}
+
+	return Top(k, board, start, count), nil
+}
+
+func page(k keys.Room, board string, offset, count int) (entries []Entry) {
+	res, _ := db.Client.ZRevRangeWithScores(k.Leaderboard(board), int64(offset), int64(offset+count-1))
+
+	for i, z := range res {
+		id, _ := strconv.Atoi(z.Member)
+
+		e := Entry{Rank: offset + i + 1, Id: id, Points: int(z.Score)}
+		if board == Users {
+			e.Name, _ = db.Client.Get(k.User(id).Username())
+		}
+
+		entries = append(entries, e)
+	}
+
+	return
+}
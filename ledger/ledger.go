@@ -0,0 +1,102 @@
+package ledger
+
+import (
+	"bitbucket.org/jahfer/flux-middleman/db"
+	"bitbucket.org/jahfer/flux-middleman/keys"
+	"bitbucket.org/jahfer/flux-middleman/leaderboard"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Why points were handed out
+const (
+	Harvest = "harvest"
+	Burst   = "burst"
+)
+
+// Oldest entries are dropped past this many per player
+var MaxEntries = 500
+
+// One line of a player's points history
+type Entry struct {
+	Amount int    `json:"amount"`
+	Reason string `json:"reason"`
+	// collector the points came from
+	TeamId int   `json:"team_id"`
+	Time   int64 `json:"time"`
+	// balance after the change
+	Total int `json:"total"`
+}
+
+// Every change to a player's points goes through here. Returns the
+// player's new total.
+func Award(k keys.Room, userId int, e Entry) int {
+	total, _ := db.Client.IncrBy(k.User(userId).Points(), int64(e.Amount))
+	leaderboard.AddPoints(k, userId, e.Amount)
+
+	e.Total = int(total)
+	if e.Time == 0 {
+		e.Time = time.Now().Unix()
+	}
+
+	record(k, userId, e)
+
+	return e.Total
+}
+
+// Put back a player's total and history, e.g. from a saved game
+func Restore(k keys.Room, userId, total int, history []Entry) {
+	db.Client.Set(k.User(userId).Points(), strconv.Itoa(total))
+	leaderboard.SetUser(k, userId, total)
+
+	db.Client.Del(k.User(userId).Ledger())
+	// history is newest first, so push from the back
+	for i := len(history) - 1; i >= 0; i-- {
+		record(k, userId, history[i])
+	}
+}
+
+// Wipe a player's total and history, e.g. for a new round
+func Clear(k keys.Room, userId int) {
+	db.Client.Del(k.User(userId).Points(), k.User(userId).Ledger())
+}
+
+func record(k keys.Room, userId int, e Entry) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		fmt.Printf("[ERROR]\tCould not record points for user %v. %v\n", userId, err)
+		return
+	}
+
+	key := k.User(userId).Ledger()
+	db.Client.LPush(key, string(data))
+	db.Client.LTrim(key, 0, int64(MaxEntries-1))
+}
+
+func Total(k keys.Room, userId int) int {
+	return db.GetInt(k.User(userId).Points())
+}
+
+// Newest first
+func History(k keys.Room, userId, offset, count int) (history []Entry) {
+	if offset < 0 {
+		offset = 0
+	}
+	if count < 1 {
+		return
+	}
+
+	raw, _ := db.Client.LRange(k.User(userId).Ledger(), int64(offset), int64(offset+count-1))
+
+	for _, line := range raw {
+		e := Entry{}
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			continue
+		}
+		history = append(history, e)
+	}
+
+	return
+}
@@ -0,0 +1,52 @@
+package ledger
+
+import (
+	"bitbucket.org/jahfer/flux-middleman/db"
+	"bitbucket.org/jahfer/flux-middleman/keys"
+	"bitbucket.org/jahfer/flux-middleman/leaderboard"
+	"testing"
+)
+
+func TestAwardKeepsHistory(t *testing.T) {
+	db.Client = db.NewMemory()
+	k := keys.ForRoom("")
+
+	Award(k, 1, Entry{Amount: 10, Reason: Harvest, TeamId: 0})
+	Award(k, 1, Entry{Amount: 5, Reason: Burst, TeamId: 0})
+
+	if total := Total(k, 1); total != 15 {
+		t.Errorf("Got total %v, expected 15", total)
+	}
+
+	history := History(k, 1, 0, 10)
+	if len(history) != 2 {
+		t.Fatalf("Got %v entries, expected 2", len(history))
+	}
+	if history[0].Reason != Burst || history[0].Total != 15 {
+		t.Errorf("Newest entry is %+v", history[0])
+	}
+
+	top := leaderboard.Top(k, leaderboard.Users, 0, 1)
+	if len(top) != 1 || top[0].Points != 15 {
+		t.Errorf("Leaderboard shows %+v", top)
+	}
+}
+
+func TestClearForgetsPoints(t *testing.T) {
+	db.Client = db.NewMemory()
+	k := keys.ForRoom("")
+
+	Award(k, 1, Entry{Amount: 10, Reason: Harvest, TeamId: 0})
+	Clear(k, 1)
+	leaderboard.Clear(k)
+
+	if total := Total(k, 1); total != 0 {
+		t.Errorf("Got total %v after clearing", total)
+	}
+	if history := History(k, 1, 0, 10); len(history) != 0 {
+		t.Errorf("History survived clearing: %+v", history)
+	}
+	if size := leaderboard.Size(k, leaderboard.Users); size != 0 {
+		t.Errorf("Leaderboard still holds %v players", size)
+	}
+}
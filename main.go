@@ -1,27 +1,92 @@
 package main
 
 import (
+	"bitbucket.org/jahfer/flux-middleman/achievements"
+	"bitbucket.org/jahfer/flux-middleman/badges"
+	"bitbucket.org/jahfer/flux-middleman/cooldown"
 	"bitbucket.org/jahfer/flux-middleman/db"
 	"bitbucket.org/jahfer/flux-middleman/events"
+	"bitbucket.org/jahfer/flux-middleman/game"
 	"bitbucket.org/jahfer/flux-middleman/helper"
+	"bitbucket.org/jahfer/flux-middleman/input"
+	"bitbucket.org/jahfer/flux-middleman/keys"
+	"bitbucket.org/jahfer/flux-middleman/leaderboard"
+	"bitbucket.org/jahfer/flux-middleman/ledger"
 	"bitbucket.org/jahfer/flux-middleman/network"
 	"bitbucket.org/jahfer/flux-middleman/client"
+	"bitbucket.org/jahfer/flux-middleman/cluster"
 	"bitbucket.org/jahfer/flux-middleman/packet"
+	"bitbucket.org/jahfer/flux-middleman/profile"
+	"bitbucket.org/jahfer/flux-middleman/room"
 	"bitbucket.org/jahfer/flux-middleman/tcp"
 	"bitbucket.org/jahfer/flux-middleman/team"
 	"bitbucket.org/jahfer/flux-middleman/user"
 	"encoding/json"
+	"flag"
 	"fmt"
-	r "github.com/vmihailenco/redis"
 	"html/template"
+	"image/color"
+	"io"
 	"net/http"
+	"os"
+	"os/signal"
 	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
-var teams = team.NewManager()
+var palette = flag.String("palette", "", "comma-separated team colors, e.g. #FF0000,#00FF00")
+var startup = flag.String("startup", db.Fresh, "what to do with data from the last run: fresh clears it, resume restores the saved teams, keep leaves it alone; only the server's own keys are cleared")
+var restore = flag.Bool("restore", false, "shorthand for -startup=resume")
+var snapshotInterval = flag.Duration("snapshot", 30*time.Second, "how often the team roster is saved")
+var roundLength = flag.Duration("round", 5*time.Minute, "length of a round")
+var countdownLength = flag.Duration("countdown", 10*time.Second, "countdown before a round starts")
+var autoStart = flag.Bool("auto-start", true, "start each room's round as soon as it opens, and the next once it ends, for displays that never send game:start")
+var badgeRules = flag.String("badges", "badges.json", "file holding the badge rules")
+var badgeCatalog = flag.String("catalog", "catalog.json", "file holding badge titles, descriptions and icons")
+var leaderboardRate = flag.Duration("leaderboard-rate", 5*time.Second, "how often leaderboards are pushed out")
+var spectatorRate = flag.Duration("spectator-rate", time.Second, "how often spectators get a scoreboard update")
+var rateLimits = flag.String("rate-limits", "", "per-connection event limits overriding the defaults, e.g. user:touch=60/120,user:attack=5/10")
+var floodStrikes = flag.Int("flood-strikes", 100, "dropped events within -flood-window before a client is disconnected (0 never disconnects)")
+var floodWindow = flag.Duration("flood-window", 10*time.Second, "window over which dropped events are counted")
+var touchRate = flag.Int("touch-rate", 30, "times per second coalesced touches are sent to the display (0 sends every touch)")
+var cooldownSpec = flag.String("cooldowns", "attack=1s,shoot=200ms,bloat=500ms", "minimum time between a player's actions")
+var budgetSpec = flag.String("team-budgets", "", "actions a team may take per window, e.g. attack=10/5s,bloat=4/10s")
+var storeName = flag.String("store", "redis", "where game data is kept: redis, or memory for a throwaway game")
+var keyPrefix = flag.String("key-prefix", "", "put in front of every key, e.g. flux: to share a database with other servers")
+var redisAddr = flag.String("redis-addr", "localhost:6379", "address of the Redis server")
+var redisPassword = flag.String("redis-password", "", "password for the Redis server")
+var redisDb = flag.Int64("redis-db", -1, "Redis database index (-1 keeps the server default)")
+var redisPool = flag.Int("redis-pool", 10, "most connections kept open to Redis")
+var redisDialTimeout = flag.Duration("redis-dial-timeout", 5*time.Second, "how long to wait when connecting to Redis")
+var redisReadTimeout = flag.Duration("redis-read-timeout", 3*time.Second, "how long to wait for a reply from Redis")
+var redisWriteTimeout = flag.Duration("redis-write-timeout", 3*time.Second, "how long to wait when sending to Redis")
+var redisSpawn = flag.Bool("redis-spawn", false, "start a local redis-server if none is running")
+var profileStore = flag.String("profiles", "", "where lifetime player profiles are kept: mysql, memory, or empty to keep none")
+var mysqlAddr = flag.String("mysql-addr", "127.0.0.1:3306", "address of the MySQL server holding profiles")
+var mysqlUser = flag.String("mysql-user", "root", "MySQL user")
+var mysqlPassword = flag.String("mysql-password", "", "MySQL password")
+var mysqlDb = flag.String("mysql-db", "flux", "MySQL database holding profiles")
+var nameMin = flag.Int("name-min", 1, "fewest characters in a player's name")
+var nameMax = flag.Int("name-max", 16, "most characters in a player's name")
+var nameBlocklist = flag.String("name-blocklist", "blocklist.txt", "file holding words players can't use in their names")
+var nameCollision = flag.String("name-collision", user.Suffix, "what to do when a player picks a name already in use: suffix adds a number, reject turns them away")
+var clusterRole = flag.String("cluster", "", "run as one of several servers sharing Redis: primary runs the game, edge only holds phone connections")
+var httpAddr = flag.String("http-addr", ":80", "address phones connect to")
+var tcpAddr = flag.String("tcp-addr", ":8100", "address XNA displays connect to")
+var splitName = flag.String("split", "equal", "how burst points are shared: equal, proportional or hybrid")
+
+// team colors for every room, when overridden by -palette
+var roomPalette []color.Color
+
+// parsed from -cooldowns and -team-budgets
+var actionCooldowns map[string]time.Duration
+var teamBudgets map[string]cooldown.Budget
+
+// handler for an event sent from inside a room
+type roomHandler func(rm *room.Room, e events.Event) interface{}
 
 func main() {
 
@@ -34,60 +99,650 @@ func main() {
 	fmt.Println("")
 	fmt.Println("===============================================")
 
+	flag.Parse()
+
+	if *palette != "" {
+		colors, err := team.ParsePalette(*palette)
+		if err != nil {
+			fmt.Printf("[ERROR]\tCould not parse palette. %v\n", err)
+		} else {
+			roomPalette = colors
+		}
+	}
+
+	if engine, err := achievements.Load(*badgeRules); err != nil {
+		fmt.Printf("[ERROR]\tCould not load badge rules. %v\n", err)
+	} else {
+		achievements.Default = engine
+	}
+
+	if err := badges.Load(*badgeCatalog); err != nil {
+		fmt.Printf("[ERROR]\tCould not load badge catalog. %v\n", err)
+	}
+
+	user.Names.MinLength = *nameMin
+	user.Names.MaxLength = *nameMax
+	if words, err := user.LoadBlocklist(*nameBlocklist); err != nil {
+		fmt.Printf("[ERROR]\tCould not load name blocklist. %v\n", err)
+	} else {
+		user.Names.SetBlocklist(words)
+	}
+
+	if _, ok := team.Splits[*splitName]; !ok {
+		fmt.Printf("[ERROR]\tUnknown split strategy %q, sharing points equally\n", *splitName)
+		*splitName = "equal"
+	}
+
+	limiter := events.NewLimiter(events.DefaultLimits)
+	limiter.MaxStrikes = *floodStrikes
+	limiter.Window = *floodWindow
+	if limits, err := events.ParseLimits(*rateLimits); err != nil {
+		fmt.Printf("[ERROR]\tCould not parse rate limits. %v\n", err)
+	} else {
+		for name, limit := range limits {
+			limiter.Set(name, limit)
+		}
+	}
+	network.Manager.Limiter = limiter
+
+	var err error
+	if actionCooldowns, err = cooldown.ParseCooldowns(*cooldownSpec); err != nil {
+		fmt.Printf("[ERROR]\tCould not parse cooldowns. %v\n", err)
+	}
+	if teamBudgets, err = cooldown.ParseBudgets(*budgetSpec); err != nil {
+		fmt.Printf("[ERROR]\tCould not parse team budgets. %v\n", err)
+	}
+
+	keys.Prefix = *keyPrefix
+
+	db.RedisOptions.Addr = *redisAddr
+	db.RedisOptions.Password = *redisPassword
+	db.RedisOptions.DB = *redisDb
+	db.RedisOptions.PoolSize = *redisPool
+	db.RedisOptions.DialTimeout = *redisDialTimeout
+	db.RedisOptions.ReadTimeout = *redisReadTimeout
+	db.RedisOptions.WriteTimeout = *redisWriteTimeout
+	db.RedisOptions.Spawn = *redisSpawn
+
+	switch *storeName {
+	case "redis":
+	case "memory":
+		db.Client = db.NewMemory()
+	default:
+		fmt.Printf("[ERROR]\tUnknown store %q, using redis\n", *storeName)
+	}
+
+	network.HttpAddr = *httpAddr
+	network.TcpAddr = *tcpAddr
+
+	if !cluster.IsRole(*clusterRole) {
+		fmt.Printf("[ERROR]\tUnknown cluster role %q, running on its own\n", *clusterRole)
+		*clusterRole = ""
+	}
+	if *clusterRole != "" && *storeName == "memory" {
+		fmt.Printf("[ERROR]\tCluster mode needs the redis store, running on its own\n")
+		*clusterRole = ""
+	}
+	cluster.Role = *clusterRole
+
+	if cluster.Role == cluster.Edge {
+		runEdge()
+		return
+	}
+
+	profile.SQLOptions.Addr = *mysqlAddr
+	profile.SQLOptions.User = *mysqlUser
+	profile.SQLOptions.Password = *mysqlPassword
+	profile.SQLOptions.Database = *mysqlDb
+
+	switch *profileStore {
+	case "":
+	case "mysql":
+		if store, err := profile.NewSQL(profile.SQLOptions); err != nil {
+			fmt.Printf("[ERROR]\tCould not open the profile database, profiles are off. %v\n", err)
+		} else {
+			profile.Client = store
+		}
+	case "memory":
+		profile.Client = profile.NewMemory()
+	default:
+		fmt.Printf("[ERROR]\tUnknown profile store %q, profiles are off\n", *profileStore)
+	}
+
+	openRoom(room.DefaultCode)
+
 	http.HandleFunc("/perf", performanceHandler)
 
 	network.Manager.HandleFunc("user:new", onUserJoin)
-	network.Manager.HandleFunc("user:touch", onUserTouch)
+	network.Manager.HandleFunc("user:touch", inRoom(whileRunning(onUserTouch)))
 	network.Manager.HandleFunc("user:disconnect", onUserDisconnect)
-	network.Manager.HandleFunc("user:heartbeat", onUserHeartbeat)
+	network.Manager.HandleFunc("user:heartbeat", inRoom(onUserHeartbeat))
 
-	network.Manager.HandleFunc("user:touchEnd", forwardEvent("user:touchEnd"))
-	network.Manager.HandleFunc("user:bloat", forwardEvent("user:bloat"))
-	network.Manager.HandleFunc("user:bloatEnd", forwardEvent("user:bloatEnd"))
-	network.Manager.HandleFunc("user:pinch", forwardEvent("user:pinch"))
-	network.Manager.HandleFunc("user:pinchEnd", forwardEvent("user:pinchEnd"))
-	network.Manager.HandleFunc("user:attack", onUserAttack)
+	network.Manager.HandleFunc("user:touchEnd", inRoom(whileRunning(counted(team.Touch, afterTouches(forwardEvent("user:touchEnd"))))))
+	network.Manager.HandleFunc("user:bloat", inRoom(whileRunning(cooledDown("bloat", counted(team.Bloat, forwardEvent("user:bloat"))))))
+	network.Manager.HandleFunc("user:bloatEnd", inRoom(whileRunning(endsAction("bloat", forwardEvent("user:bloatEnd")))))
+	network.Manager.HandleFunc("user:pinch", inRoom(whileRunning(counted(team.Pinch, forwardEvent("user:pinch")))))
+	network.Manager.HandleFunc("user:pinchEnd", inRoom(whileRunning(afterTouches(forwardEvent("user:pinchEnd")))))
+	network.Manager.HandleFunc("user:attack", inRoom(whileRunning(onUserAttack)))
 
-	network.Manager.HandleFunc("collector:merge", onCollectorMerge)
-	network.Manager.HandleFunc("collector:burst", onCollectorBurst)
-	network.Manager.HandleFunc("collector:heartbeat", onCollectorHeartbeat)
+	network.Manager.HandleFunc("collector:merge", inRoom(whileRunning(onCollectorMerge)))
+	network.Manager.HandleFunc("collector:burst", inRoom(whileRunning(onCollectorBurst)))
+	network.Manager.HandleFunc("collector:heartbeat", inRoom(onCollectorHeartbeat))
 
 	// from XNA
-	network.Manager.HandleFunc("user:shoot", onUserShoot)
+	network.Manager.HandleFunc("user:shoot", inRoom(whileRunning(onUserShoot)))
+
+	network.Manager.HandleFunc("room:create", displayOnly(onRoomCreate))
+	network.Manager.HandleFunc("room:close", displayOnly(inRoom(onRoomClose)))
+	network.Manager.HandleFunc("display:join", displayOnly(onDisplayJoin))
+	network.Manager.HandleFunc("display:resolution", inRoom(onDisplayResolution))
+
+	network.Manager.HandleFunc("game:start", displayOnly(inRoom(onGameControl((*game.Session).Start))))
+	network.Manager.HandleFunc("game:pause", displayOnly(inRoom(onGameControl((*game.Session).Pause))))
+	network.Manager.HandleFunc("game:resume", displayOnly(inRoom(onGameControl((*game.Session).Resume))))
+	network.Manager.HandleFunc("game:end", displayOnly(inRoom(onGameControl((*game.Session).End))))
+	network.Manager.HandleFunc("game:reset", displayOnly(inRoom(onGameControl((*game.Session).Reset))))
 
+	if !user.IsCollisionMode(*nameCollision) {
+		fmt.Printf("[ERROR]\tUnknown name collision mode %q, adding a number\n", *nameCollision)
+		*nameCollision = user.Suffix
+	}
+	user.OnCollision = *nameCollision
+
+	if *restore {
+		*startup = db.Resume
+	}
+	if !db.IsStartup(*startup) {
+		fmt.Printf("[ERROR]\tUnknown startup mode %q, starting fresh\n", *startup)
+		*startup = db.Fresh
+	}
+	db.Startup = *startup
+
+	if *startup == db.Resume {
+		go restoreTeams()
+	}
+
+	if cluster.Role == cluster.Primary {
+		go listenToEdges()
+	}
 
-	go teams.Run()
 	go cleanup()
+	go updateSpectators()
+	go pushLeaderboards()
+	go saveOnExit()
 
 	network.Init()
 }
 
+// Hold phone connections for the primary, which runs the game. The
+// data is the primary's, so it's left alone on startup.
+func runEdge() {
+	db.Startup = db.Keep
+
+	bridge := cluster.NewBridge(&network.WsClients)
+	network.Manager.Relay = bridge.Relay
+
+	go func() {
+		<-network.Ready
+		if err := bridge.Listen(); err != nil {
+			fmt.Printf("[ERROR]\tCould not listen to the primary. %v\n", err)
+		}
+	}()
+
+	network.Init()
+}
+
+// Take in events from phones connected to the edges
+func listenToEdges() {
+	<-network.Ready
+
+	if err := cluster.ListenPrimary(network.Manager.Incoming); err != nil {
+		fmt.Printf("[ERROR]\tCould not listen to the edges. %v\n", err)
+	}
+}
+
 func cleanup() {
 	ticker := time.NewTicker(5 * time.Second)
+	snapshot := time.NewTicker(*snapshotInterval)
 
 	for {
 		select {
 		case <-ticker.C:
-			teams.CheckExpired()
-			teams.Analytics()
+			for _, rm := range room.All() {
+				rm.Teams.CheckExpired()
+			}
+		case <-snapshot.C:
+			saveRooms()
+		}
+	}
+}
+
+// Keep second screens up to date on every room somebody is watching
+func updateSpectators() {
+	ticker := time.NewTicker(*spectatorRate)
+
+	for _ = range ticker.C {
+		for _, rm := range room.All() {
+			if rm.NumSpectators() > 0 {
+				rm.Scope.BroadcastSpectators(packet.Out{Name: "spectator:update", Message: spectatorState(rm)})
+			}
 		}
 	}
 }
 
-func forwardEvent(evtName string) func(e events.Event) interface{} {
+// Send the top of each room's boards to its phones and displays
+func pushLeaderboards() {
+	ticker := time.NewTicker(*leaderboardRate)
+
+	for _ = range ticker.C {
+		for _, rm := range room.All() {
+			rm.Teams.RefreshLeaderboard()
+
+			users := leaderboard.Top(rm.Scope.Keys, leaderboard.Users, 0, 10)
+			teams := leaderboard.Top(rm.Scope.Keys, leaderboard.Teams, 0, 10)
+
+			update := packet.Out{
+				Name: "leaderboard:update",
+				Message: struct {
+					Users []leaderboard.Entry `json:"users"`
+					Teams []leaderboard.Entry `json:"teams"`
+				}{users, teams},
+			}
+			rm.Scope.BroadcastPhones(update)
+			rm.Scope.BroadcastSpectators(update)
+
+			sendLeaderboardToXna(rm, leaderboard.Users, users)
+			sendLeaderboardToXna(rm, leaderboard.Teams, teams)
+		}
+	}
+}
+
+// XNA only reads flat messages, so send one line per entry
+func sendLeaderboardToXna(rm *room.Room, board string, entries []leaderboard.Entry) {
+	for _, entry := range entries {
+		msg := struct {
+			Name   string `tcp:"name"`
+			Board  string `tcp:"board"`
+			Rank   int    `tcp:"rank"`
+			Id     int    `tcp:"id"`
+			Points int    `tcp:"points"`
+		}{"leaderboard:update", board, entry.Rank, entry.Id, entry.Points}
+		rm.Scope.BroadcastXna(msg)
+	}
+}
+
+func spectatorState(rm *room.Room) interface{} {
+	return struct {
+		Room      string              `json:"room"`
+		Game      game.Status         `json:"game"`
+		Teams     []team.TeamOverview `json:"teams"`
+		Standings team.Standings      `json:"standings"`
+	}{rm.Code, rm.Session.Status(), rm.Teams.Overview(), rm.Teams.Standings()}
+}
+
+func saveRooms() {
+	for _, rm := range room.All() {
+		if err := rm.Teams.Save(); err != nil {
+			fmt.Printf("[ERROR]\tCould not save team snapshot for room %q. %v\n", rm.Code, err)
+		}
+	}
+}
+
+func restoreTeams() {
+	<-network.Ready
+
+	snapshots, err := db.Find(keys.Snapshots())
+	if err != nil {
+		fmt.Printf("[ERROR]\tCould not look for saved teams. %v\n", err)
+	}
+	for _, key := range snapshots {
+		code := keys.RoomFromKey(key)
+
+		rm, ok := room.Get(code)
+		if !ok {
+			rm = openRoom(code)
+		}
+
+		restored, err := rm.Teams.Restore()
+		if err != nil {
+			fmt.Printf("[NOTICE]\tNo team snapshot restored for room %q. %v\n", code, err)
+			continue
+		}
+
+		fmt.Printf("[NOTICE]\tRestored %v player(s) from snapshot of room %q\n", restored, code)
+	}
+}
+
+// Save the roster one last time before going down
+func saveOnExit() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+
+	saveRooms()
+	for _, rm := range room.All() {
+		for _, members := range rm.Teams.Members() {
+			for _, m := range members {
+				if p, ok := takeProfile(rm, m.User.Id, 0); ok {
+					addProfile(p)
+				}
+			}
+		}
+	}
+
+	os.Exit(0)
+}
+
+// Set up a room with its own round, using the configured palette
+func openRoom(code string) *room.Room {
+	session := game.NewSession(*roundLength, *countdownLength)
+	rm := room.New(code, session)
+
+	session.OnChange = func(from, to game.State, status game.Status) {
+		onGameChange(rm, from, to, status)
+	}
+	if *autoStart {
+		session.Start()
+	}
+
+	if roomPalette != nil {
+		rm.Teams.Colors.SetPalette(roomPalette)
+	}
+	rm.Teams.Split = team.Splits[*splitName]
+	rm.Cooldowns = cooldown.NewTracker(actionCooldowns, teamBudgets)
+	rm.Teams.OnLeave = func(userId int) {
+		if p, ok := takeProfile(rm, userId, 0); ok {
+			go addProfile(p)
+		}
+		rm.Profiles.End(userId)
+		rm.Screens.ForgetViewport(userId)
+		achievements.Default.ForgetUser(rm.Scope, userId)
+		rm.Cooldowns.ForgetUser(userId)
+	}
+	rm.Teams.OnTeamGone = func(teamId int) {
+		rm.Cooldowns.ForgetTeam(teamId)
+	}
+
+	if *touchRate > 0 {
+		rm.Touches = input.NewAggregator(func(pos user.Coords) {
+			forwardTouch(rm, pos)
+		})
+		go rm.Touches.Run(*touchRate)
+	}
+
+	return rm
+}
+
+// Look up the room the sender has joined before handling the event.
+// Spectators only get to watch.
+func inRoom(handler roomHandler) func(e events.Event) interface{} {
+	return func(e events.Event) interface{} {
+		if room.IsSpectator(e.Sender) {
+			return packet.Out{Name: "user:error", Message: "Spectators cannot send " + e.Name}
+		}
+
+		rm := room.ForConn(e.Sender)
+		if rm.IsClosed() {
+			return packet.Out{Name: "user:error", Message: "Room has closed: " + rm.Code}
+		}
+		return handler(rm, e)
+	}
+}
+
+// Only take the event from an XNA display
+func displayOnly(handler func(e events.Event) interface{}) func(e events.Event) interface{} {
 	return func(e events.Event) interface{} {
+		if _, ok := e.Sender.(*client.TcpClient); !ok {
+			return packet.Out{Name: "user:error", Message: "Only displays can send " + e.Name}
+		}
+		return handler(e)
+	}
+}
+
+// Reply to an XNA display in its own format
+func replyXna(e events.Event, msg interface{}) {
+	if c, ok := e.Sender.(client.Client); ok {
+		c.Write(c.Format(msg))
+	}
+}
+
+func sendRoomInfo(e events.Event, code string) {
+	msg := struct {
+		Name string `tcp:"name"`
+		Code string `tcp:"code"`
+	}{"room:info", code}
+	replyXna(e, msg)
+}
+
+// A display is starting a fresh game under a new join code
+func onRoomCreate(e events.Event) interface{} {
+	rm := openRoom(room.NewCode())
+
+	db.Client.SetNX(rm.Scope.Keys.NextUserId(), "0")
+	db.Client.SetNX(rm.Scope.Keys.NextTeamId(), "0")
+
+	room.Attach(e.Sender, rm)
+	sendRoomInfo(e, rm.Code)
+
+	return nil
+}
+
+// e.g. /name=display:join/room=ABCD$
+func onDisplayJoin(e events.Event) interface{} {
+	d := struct {
+		Room string `tcp:"room"`
+	}{}
+	tcp.Unmarshal(e.Args, &d)
+
+	rm, ok := room.Get(strings.ToUpper(d.Room))
+	if !ok {
+		msg := struct {
+			Name string `tcp:"name"`
+			Code string `tcp:"code"`
+		}{"room:notFound", d.Room}
+		replyXna(e, msg)
+		return nil
+	}
+
+	// the display's resolution goes with it
+	if v, ok := room.ForConn(e.Sender).Screens.TakeDisplay(e.Sender); ok {
+		rm.Screens.SetDisplay(e.Sender, v)
+	}
+
+	room.Attach(e.Sender, rm)
+	sendRoomInfo(e, rm.Code)
+
+	return nil
+}
+
+// e.g. /name=display:resolution/width=1920/height=1080$
+func onDisplayResolution(rm *room.Room, e events.Event) interface{} {
+	d := struct {
+		Width  float64 `tcp:"width"`
+		Height float64 `tcp:"height"`
+	}{}
+	tcp.Unmarshal(e.Args, &d)
+
+	rm.Screens.SetDisplay(e.Sender, user.Viewport{Width: d.Width, Height: d.Height})
+	return nil
+}
+
+func onRoomClose(rm *room.Room, e events.Event) interface{} {
+	// the default room stays open, and keeps flushing its touches
+	if rm.Code == room.DefaultCode {
+		return nil
+	}
+
+	// players keep what they earned before the room goes away
+	saveProfiles(rm, 0)
+
+	if !room.Close(rm.Code) {
+		return nil
+	}
+
+	// everyone still attached is turned away from now on
+	msg := struct {
+		Name string `tcp:"name"`
+		Code string `tcp:"code"`
+	}{"room:closed", rm.Code}
+	rm.Scope.BroadcastXna(msg)
+	rm.Scope.BroadcastPhones(packet.Out{Name: "room:closed", Message: rm.Code})
+	rm.Scope.BroadcastSpectators(packet.Out{Name: "room:closed", Message: rm.Code})
+
+	return nil
+}
+
+// Drop gameplay events unless the room's round is under way
+func whileRunning(handler roomHandler) roomHandler {
+	return func(rm *room.Room, e events.Event) interface{} {
+		if rm.Session.IsRunning() {
+			return handler(rm, e)
+		}
+
+		// displays hear about the round from onGameChange
+		if _, ok := e.Sender.(*client.TcpClient); ok {
+			return nil
+		}
+
+		// let the phone know why nothing happened, once per state
+		if !rm.Tell(e.Sender) {
+			return nil
+		}
+		return packet.Out{Name: "game:state", Message: rm.Session.Status()}
+	}
+}
+
+func onGameControl(action func(s *game.Session) error) roomHandler {
+	return func(rm *room.Room, e events.Event) interface{} {
+		if err := action(rm.Session); err != nil {
+			fmt.Printf("[NOTICE]\t%v\n", err)
+		}
+		return nil
+	}
+}
+
+// Tell everyone in the room the game has moved on
+func onGameChange(rm *room.Room, from, to game.State, status game.Status) {
+	fmt.Printf("[NOTICE]\tGame in room %q %v -> %v\n", rm.Code, from, to)
+	rm.Untell()
+
+	// every round starts from nothing
+	if to == game.Lobby {
+		rm.Teams.ResetPoints()
+		rm.Profiles.ResetPoints()
+	}
+
+	msg := struct {
+		Name      string `tcp:"name"`
+		State     string `tcp:"state"`
+		Remaining int    `tcp:"remaining"`
+	}{"game:state", status.State, status.Remaining}
+	rm.Scope.BroadcastXna(msg)
+
+	rm.Scope.BroadcastPhones(packet.Out{Name: "game:state", Message: status})
+	rm.Scope.BroadcastSpectators(packet.Out{Name: "game:state", Message: status})
+
+	if to == game.Ended {
+		sendStandings(rm)
+		saveProfiles(rm, 1)
+	}
+
+	// displays that never send game:start never send game:reset either
+	if to == game.Ended && *autoStart {
+		rm.Session.Reset()
+		rm.Session.Start()
+	}
+}
+
+// Final results: full table for the phones, one line per team for XNA
+func sendStandings(rm *room.Room) {
+	standings := rm.Teams.Standings()
+
+	for rank, ts := range standings.Teams {
+		msg := struct {
+			Name   string `tcp:"name"`
+			Id     int    `tcp:"id"`
+			Rank   int    `tcp:"rank"`
+			Points int    `tcp:"points"`
+		}{"game:standing", ts.Id, rank + 1, ts.Points}
+		rm.Scope.BroadcastXna(msg)
+	}
+
+	rm.Scope.BroadcastPhones(packet.Out{Name: "game:standings", Message: standings})
+	rm.Scope.BroadcastSpectators(packet.Out{Name: "game:standings", Message: standings})
+}
+
+func forwardEvent(evtName string) roomHandler {
+	return func(rm *room.Room, e events.Event) interface{} {
 		u := events.GetUserId(e)
 		// forward to XNA
-		helper.ToXna(evtName, u.Id)
+		helper.ToXna(rm.Scope, evtName, u.Id)
 		return nil
 	}
 }
 
-func onUserAttack(e events.Event) interface{} {
+// Credit the sender's team contribution before handling the event
+func counted(a team.Action, handler roomHandler) roomHandler {
+	return func(rm *room.Room, e events.Event) interface{} {
+		u := events.GetUserId(e)
+		rm.Teams.Contributions.Record(u.Id, a)
+		return handler(rm, e)
+	}
+}
+
+// Only handle the event once the sender's cooldown has run out
+func cooledDown(action string, handler roomHandler) roomHandler {
+	return func(rm *room.Room, e events.Event) interface{} {
+		u := events.GetUserId(e)
+		if !tryAction(rm, action, u.Id, teamOf(rm, u.Id)) {
+			return nil
+		}
+		return handler(rm, e)
+	}
+}
+
+// Only handle the event if it ends a use of the action that got
+// through, so a turned down bloat's bloatEnd goes nowhere
+func endsAction(action string, handler roomHandler) roomHandler {
+	return func(rm *room.Room, e events.Event) interface{} {
+		u := events.GetUserId(e)
+		if rm.Cooldowns != nil && !rm.Cooldowns.End(action, u.Id) {
+			return nil
+		}
+		return handler(rm, e)
+	}
+}
+
+// Check the player's cooldown and their team's budget, letting the
+// phone know how long to wait when the action is turned down
+func tryAction(rm *room.Room, action string, userId, teamId int) bool {
+	if rm.Cooldowns == nil {
+		return true
+	}
+
+	ok, remaining := rm.Cooldowns.Try(action, userId, teamId)
+	if !ok {
+		msg := struct {
+			Action    string  `json:"action"`
+			Remaining float64 `json:"remaining"`
+		}{action, remaining.Seconds()}
+		rm.Scope.ToPhone(userId, packet.Out{Name: "user:cooldown", Message: msg})
+	}
+
+	return ok
+}
+
+func teamOf(rm *room.Room, userId int) int {
+	return db.GetInt(rm.Scope.Keys.User(userId).Team())
+}
+
+func onUserAttack(rm *room.Room, e events.Event) interface{} {
 	u := events.GetUserId(e)
+	teamId := teamOf(rm, u.Id)
 
-	userTeamKey := fmt.Sprintf("uid:%v:team", u.Id)
-	teamId, _ := strconv.Atoi(db.Redis.Get(userTeamKey).Val())
+	if !tryAction(rm, "attack", u.Id, teamId) {
+		return nil
+	}
 
 	// forward to XNA
 	msg := struct {
@@ -95,12 +750,12 @@ func onUserAttack(e events.Event) interface{} {
 		Id   int    `tcp:"id"`
 		UserId int 	`tcp:"userId"`
 	}{"collector:attack", teamId, u.Id}
-	network.TcpClients.Broadcast <- msg
+	rm.Scope.BroadcastXna(msg)
 	//helper.ToXna("collector:attack", teamId)
 	return nil
 }
 
-func onUserShoot(e events.Event) interface{} {
+func onUserShoot(rm *room.Room, e events.Event) interface{} {
 	// e.g. /name=user:shoot/id=1$
 	defer func() {
 		if r := recover(); r != nil {
@@ -116,8 +771,13 @@ func onUserShoot(e events.Event) interface{} {
 		panic(err.Error())
 	}
 
-	userShotKey := fmt.Sprintf("uid:%v:shotsFired", u.Id)
-	db.Redis.Incr(userShotKey)
+	// XNA has already fired; just don't give credit for it
+	if !tryAction(rm, "shoot", u.Id, teamOf(rm, u.Id)) {
+		return nil
+	}
+
+	rm.Teams.Contributions.Record(u.Id, team.Shot)
+	achievements.Emit(rm.Scope, achievements.Event{Name: "user:shoot", UserId: u.Id})
 	fmt.Printf("Shots fired!: %v\n", u.Id)
 
 	return nil
@@ -137,17 +797,67 @@ func onUserJoin(e events.Event) interface{} {
 	}
 
 	u.Name = client.Sanitizer.ReplaceAllString(u.Name, "")
+	u.Room = strings.ToUpper(client.Sanitizer.ReplaceAllString(u.Room, ""))
+
+	rm, found := room.Get(u.Room)
+	if !found {
+		return packet.Out{Name: "user:error", Message: "Room not found: " + u.Room}
+	}
 
-	if err, err2 := u.Save(); err != nil || err2 != nil {
-		fmt.Printf("[ERROR]\tCould not save user. " + err.Error() + " " + err2.Error() + "\n")
+	// second screens watch without taking a spot on a team
+	mode := struct {
+		Spectate bool `json:"spectate"`
+	}{}
+	json.Unmarshal(e.Args, &mode)
+
+	if mode.Spectate {
+		room.AttachSpectator(e.Sender, rm)
+		return packet.Out{Name: "spectator:info", Message: spectatorState(rm)}
+	}
+
+	name, err := user.Names.Check(u.Name)
+	if err != nil {
+		return packet.Out{Name: "user:error", Message: err.Error()}
 	}
+	u.Name = name
 
-	// assign to team
-	member := team.Member{User: u, Conn: e.Sender}
-	teams.Queue <- member
-	// get team id - blocking
-	assignedTeamId := <-teams.LastId
-	member.User.TeamId = assignedTeamId
+	teams := rm.Teams
+
+	// player is reconnecting to a restored game
+	resumed, ok := teams.Reattach(u, e.Sender)
+
+	var assignedTeamId int
+	var member team.Member
+
+	if ok {
+		// the phone may have come back on a different screen
+		resumed.Viewport = u.Viewport
+		u = resumed
+		member = team.Member{User: u, Conn: e.Sender}
+		assignedTeamId = u.TeamId
+	} else {
+		if err, err2 := u.Save(rm.Scope.Keys); err == user.ErrNameTaken {
+			return packet.Out{Name: "user:error", Message: "Name already taken: " + u.Name}
+		} else if err != nil || err2 != nil {
+			fmt.Printf("[ERROR]\tCould not save user. %v %v\n", err, err2)
+			return packet.Out{Name: "user:error", Message: "Could not join, try again"}
+		}
+	}
+
+	// only once the player has a name in the room
+	room.Attach(e.Sender, rm)
+
+	if !ok {
+		// assign to team
+		member = team.Member{User: u, Conn: e.Sender}
+		teams.Queue <- member
+		// get team id - blocking
+		assignedTeamId = <-teams.LastId
+		member.User.TeamId = assignedTeamId
+	}
+
+	rm.Screens.SetViewport(u.Id, u.Viewport)
+	startProfile(rm, u, e.Sender)
 
 	// forward to xna
 	msg := struct {
@@ -157,56 +867,158 @@ func onUserJoin(e events.Event) interface{} {
 		TeamId   int    `tcp:"teamId"`
 		Display  int    `tcp:"display"`
 	}{"user:new", u.Id, strings.ToUpper(u.Name), assignedTeamId, u.Display}
-	network.TcpClients.Broadcast <- msg
+	rm.Scope.BroadcastXna(msg)
+
+	achievements.Emit(rm.Scope, achievements.Event{Name: "user:join", UserId: u.Id, TeamId: assignedTeamId})
 
-	helper.SendBadge("join", u.Id)
+	// bring the phone up to speed on the round
+	state, _ := json.Marshal(packet.Out{Name: "game:state", Message: rm.Session.Status()})
+	e.Sender.Write(state)
 
 	// reply to sencha with user data
 	return packet.Out{ "user:info", member.User }
 }
 
-func onUserHeartbeat(e events.Event) interface{} {
-	u := events.GetUserId(e)
+// Look up the player's lifetime profile and show it on their phone
+func startProfile(rm *room.Room, u user.User, conn io.Writer) {
+	if profile.Client == nil || u.Device == "" {
+		return
+	}
 
-	score := float64(time.Now().Unix())
+	// a resumed player's points are already in their profile
+	if err := rm.Profiles.Start(u.Id, u.Device, ledger.Total(rm.Scope.Keys, u.Id)); err != nil {
+		fmt.Printf("[NOTICE]\tNot keeping a profile for user %v. %v\n", u.Id, err)
+		return
+	}
 
-	heartbeat := r.Z{
-		score,
-		strconv.Itoa(u.Id),
+	// keep the database off the event loop
+	go func() {
+		p, err := profile.Client.Load(u.Device)
+		if err != nil {
+			fmt.Printf("[ERROR]\tCould not load profile %q. %v\n", u.Device, err)
+			return
+		}
+
+		network.Manager.Dispatch(func() {
+			// the player may have left while it loaded
+			if c, ok := rm.Teams.Conn(u.Id); !ok || c != conn {
+				return
+			}
+
+			out, _ := json.Marshal(packet.Out{Name: "user:profile", Message: p})
+			conn.Write(out)
+		})
+	}()
+}
+
+// What the player has earned since their profile was last saved
+func takeProfile(rm *room.Room, userId, games int) (profile.Profile, bool) {
+	if profile.Client == nil {
+		return profile.Profile{}, false
 	}
 
-	db.Redis.ZAdd("global:clients", heartbeat)
+	k := rm.Scope.Keys
+	badgeIds, _ := db.Client.SMembers(k.User(userId).Badges())
+
+	return rm.Profiles.Take(userId, ledger.Total(k, userId), games, badgeIds)
+}
+
+func addProfile(p profile.Profile) {
+	if err := profile.Client.Add(p); err != nil {
+		fmt.Printf("[ERROR]\tCould not save profile %q. %v\n", p.Id, err)
+	}
+}
+
+// Save everyone still playing, counting the given number of games
+func saveProfiles(rm *room.Room, games int) {
+	var played []profile.Profile
+	for _, members := range rm.Teams.Members() {
+		for _, m := range members {
+			if p, ok := takeProfile(rm, m.User.Id, games); ok {
+				played = append(played, p)
+			}
+		}
+	}
+
+	go func() {
+		for _, p := range played {
+			addProfile(p)
+		}
+	}()
+}
+
+func onUserHeartbeat(rm *room.Room, e events.Event) interface{} {
+	u := events.GetUserId(e)
+
+	score := float64(time.Now().Unix())
+
+	db.Client.ZAdd(rm.Scope.Keys.Clients(), score, strconv.Itoa(u.Id))
 
 	return nil
 }
 
 func onUserDisconnect(e events.Event) interface{} {
-	teams.Unregister <- e.Sender
+	rm := room.ForConn(e.Sender)
+	room.Detach(e.Sender)
+	rm.Screens.TakeDisplay(e.Sender)
+
+	// nobody is left to take the player off a closed room's teams
+	if !rm.IsClosed() {
+		rm.Teams.Unregister <- e.Sender
+	}
 	return nil
 }
 
-func onUserTouch(e events.Event) interface{} {
+func onUserTouch(rm *room.Room, e events.Event) interface{} {
 	// get incoming data in format of user.Coords
 	pos := user.Coords{}
 	if err := json.Unmarshal(e.Args, &pos); err != nil {
 		panic(err.Error())
 	}
 
-	// forward to XNA
-	msg := struct {
-		Name string `tcp:"name"`
-		Id   int    `tcp:"id"`
-		X    int    `tcp:"x"`
-		Y    int    `tcp:"y"`
-	}{"user:touch", pos.Id, pos.X, pos.Y}
-
-	network.TcpClients.Broadcast <- msg
+	// hold on to it until the next tick
+	if rm.Touches != nil {
+		rm.Touches.Push(pos)
+		return nil
+	}
 
+	forwardTouch(rm, pos)
 	return nil
 }
 
+// Send the touch to every display, moved onto its own screen. Touches
+// from phones that never sent their viewport are dropped.
+func forwardTouch(rm *room.Room, pos user.Coords) {
+	touch := func(c client.Client) interface{} {
+		p, ok := rm.Screens.Map(pos, c)
+		if !ok {
+			return nil
+		}
+		return struct {
+			Name string  `tcp:"name"`
+			Id   int     `tcp:"id"`
+			X    float64 `tcp:"x"`
+			Y    float64 `tcp:"y"`
+		}{"user:touch", p.Id, p.X, p.Y}
+	}
+
+	rm.Scope.BroadcastXna(client.Tailored(touch))
+}
 
-func onCollectorHeartbeat(e events.Event) interface{} {
+// Send the sender's last waiting touch before handling the event,
+// so the display sees the gesture end where it really did
+func afterTouches(handler roomHandler) roomHandler {
+	return func(rm *room.Room, e events.Event) interface{} {
+		if rm.Touches != nil {
+			u := events.GetUserId(e)
+			rm.Touches.FlushUser(u.Id)
+		}
+		return handler(rm, e)
+	}
+}
+
+
+func onCollectorHeartbeat(rm *room.Room, e events.Event) interface{} {
 	// e.g. /name=collector:heartbeat/id=0/health=90/capacity=100/fill=43/color=#FFAA99$
 
 	type collector struct {
@@ -219,17 +1031,24 @@ func onCollectorHeartbeat(e events.Event) interface{} {
 	c := collector{}
 	tcp.Unmarshal(e.Args, &c)
 
-	teamPrefix := fmt.Sprintf("team:%v:", c.Id)
+	teamKeys := rm.Scope.Keys.Team(c.Id)
 
-	db.Redis.Set(teamPrefix + "health", strconv.Itoa(c.Health))
-	db.Redis.Set(teamPrefix + "fill", strconv.Itoa(c.Fill))
-	db.Redis.Set(teamPrefix + "capacity", strconv.Itoa(c.Capacity))
-	db.Redis.Set(teamPrefix + "color", c.Color)
+	// one round trip per heartbeat
+	err := db.Client.Pipelined(func(b db.Batch) {
+		b.Set(teamKeys.Health(), strconv.Itoa(c.Health))
+		b.Set(teamKeys.Fill(), strconv.Itoa(c.Fill))
+		b.Set(teamKeys.Capacity(), strconv.Itoa(c.Capacity))
+		b.Set(teamKeys.Color(), c.Color)
+	})
+
+	if err != nil {
+		fmt.Printf("[ERROR]\tCould not store heartbeat for collector %v. %v\n", c.Id, err)
+	}
 
 	return nil
 }
 
-func onCollectorMerge(e events.Event) interface{} {
+func onCollectorMerge(rm *room.Room, e events.Event) interface{} {
 	// e.g. /name=collector:merge/team_1=0/team_2=1$
 
 	toMerge := team.Merger{}
@@ -237,12 +1056,12 @@ func onCollectorMerge(e events.Event) interface{} {
 		panic(err.Error())
 	}
 
-	teams.Merge(toMerge)
+	rm.Teams.Merge(toMerge)
 
 	return nil
 }
 
-func onCollectorBurst(e events.Event) interface{} {
+func onCollectorBurst(rm *room.Room, e events.Event) interface{} {
 	// e.g. /name=collector:burst/id=0/points=155/complete=1$
 
 	type collector struct {
@@ -255,41 +1074,28 @@ func onCollectorBurst(e events.Event) interface{} {
 	tcp.Unmarshal(e.Args, &c)
 
 	// give points!
-	if team, ok := teams.Roster[c.Id]; ok {
-		pts := c.Points / len(team)
+	if team, ok := rm.Teams.Members()[c.Id]; ok {
+		shares := rm.Teams.Distribute(c.Id, c.Points)
 
 		for _, member := range team {
+			pts := shares[member.User.Id]
 			
-			userHarvestKey := fmt.Sprintf("uid:%v:harvests", member.User.Id)
-
+			harvest := achievements.Event{Name: "collector:incomplete", UserId: member.User.Id, TeamId: c.Id}
 			if (c.Complete > 0) {
-				helper.SendBadge("firstComplete", member.User.Id)
-				rounds := db.Redis.Incr(userHarvestKey).Val()
-				if (rounds >= 3) {
-					helper.SendBadge("bumperCrop", member.User.Id)
-				}
-			} else {
-				db.Redis.Set(userHarvestKey, "0")
+				harvest.Name = "collector:complete"
 			}
+			achievements.Emit(rm.Scope, harvest)
 
-			helper.SendPoints(pts, member.User.Id)
-			userKey := fmt.Sprintf("uid:%v:points", member.User.Id)
-			totalPts := db.Redis.IncrBy(userKey, int64(pts))
-
-			toApp := packet.Out{
-				Name:    "user:getPoints",
-				Message: totalPts.Val(),
-			}
-
-			encoded, err := json.Marshal(toApp)
-			if err != nil {
-				panic(err)
+			reason := ledger.Burst
+			if (c.Complete > 0) {
+				reason = ledger.Harvest
 			}
+			ledger.Award(rm.Scope.Keys, member.User.Id, ledger.Entry{Amount: pts, Reason: reason, TeamId: c.Id})
 
-			member.Conn.Write(encoded)
+			helper.SendPoints(rm.Scope, pts, member.User.Id)
 		}
 
-		teams.ReturnToQueue(c.Id)
+		rm.Teams.ReturnToQueue(c.Id)
 	}
 
 	return nil
@@ -297,22 +1103,34 @@ func onCollectorBurst(e events.Event) interface{} {
 
 // Spit out performance statistics for entire program
 func performanceHandler(w http.ResponseWriter, r *http.Request) {
+	type roomStats struct {
+		Code  string
+		State string
+		Teams map[int][]team.Member
+	}
+
 	data := struct {
 		NumGoroutine int
 		WsNumConn    int
 		TcpNumConn   int
+		NumRooms     int
 		NumTeams     int
 		NumInQueue   int
 		NumActive    int
-		Teams        map[int][]team.Member
+		Rooms        []roomStats
 	}{
 		NumGoroutine: runtime.NumGoroutine(),
 		WsNumConn:    network.WsClients.NumClients(),
 		TcpNumConn:   network.TcpClients.NumClients(),
-		NumTeams:     len(teams.Roster),
-		NumInQueue:   len(teams.Queue),
-		NumActive:    teams.NumUsers(),
-		Teams:        teams.Roster,
+	}
+
+	for _, rm := range room.All() {
+		data.NumRooms++
+		teams := rm.Teams.Members()
+		data.NumTeams += len(teams)
+		data.NumInQueue += len(rm.Teams.Queue)
+		data.NumActive += rm.Teams.NumUsers()
+		data.Rooms = append(data.Rooms, roomStats{rm.Code, rm.Session.State().String(), teams})
 	}
 
 	t, _ := template.ParseFiles("tmpl/perf.html")
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"bitbucket.org/jahfer/flux-middleman/db"
+	"bitbucket.org/jahfer/flux-middleman/events"
+	"bitbucket.org/jahfer/flux-middleman/helper"
+	"bitbucket.org/jahfer/flux-middleman/room"
 	"code.google.com/p/go.net/websocket"
 	"fmt"
 	"net"
+	"os"
 	"testing"
 	"time"
 )
@@ -48,3 +53,50 @@ func wsConnSetup(srvAddr string) (config *websocket.Config, err error) {
 
 	return
 }
+
+// Store the heartbeat benchmarks write to. The in-memory store has no
+// round trips to save, so compare the two against a real server:
+//
+//	FLUX_BENCH_REDIS=localhost:6379 go test -run XXX -bench CollectorHeartbeat
+func benchStore() {
+	if addr := os.Getenv("FLUX_BENCH_REDIS"); addr != "" {
+		opts := db.RedisOptions
+		opts.Addr = addr
+		db.Client = db.NewRedis(opts)
+	} else {
+		db.Client = db.NewMemory()
+	}
+}
+
+// Writes pipelined, one round trip per heartbeat
+func BenchmarkCollectorHeartbeat(b *testing.B) {
+	benchStore()
+
+	rm := &room.Room{Code: "BNCH", Scope: helper.NewScope("BNCH")}
+	e := events.Event{
+		Name: "collector:heartbeat",
+		Args: []byte("/name=collector:heartbeat/id=0/health=90/capacity=100/fill=43/color=#FFAA99$"),
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		onCollectorHeartbeat(rm, e)
+	}
+}
+
+// The same writes sent one command at a time, as heartbeats used to be
+func BenchmarkCollectorHeartbeatUnpipelined(b *testing.B) {
+	benchStore()
+
+	teamKeys := helper.NewScope("BNCH").Keys.Team(0)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		db.Client.Set(teamKeys.Health(), "90")
+		db.Client.Set(teamKeys.Fill(), "43")
+		db.Client.Set(teamKeys.Capacity(), "100")
+		db.Client.Set(teamKeys.Color(), "#FFAA99")
+	}
+}
@@ -1,9 +1,14 @@
 package network
 
 import (
+	"bitbucket.org/jahfer/flux-middleman/badges"
 	"bitbucket.org/jahfer/flux-middleman/db"
+	"bitbucket.org/jahfer/flux-middleman/keys"
+	"bitbucket.org/jahfer/flux-middleman/leaderboard"
+	"bitbucket.org/jahfer/flux-middleman/ledger"
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"fmt"
 )
 
@@ -11,26 +16,33 @@ func handleApiCollector(w http.ResponseWriter, r *http.Request) {
 	out := json.NewEncoder(w)
 
 	teamId := r.FormValue("id")
-	teamCheck := db.Redis.SCard("team:" + teamId + ":users")
-	if err := teamCheck.Err(); err != nil || teamCheck.Val() == 0 {
+	k := keys.ForRoom(r.FormValue("room"))
+
+	id, err := strconv.Atoi(teamId)
+	var size int64
+	if err == nil {
+		size, err = db.Client.SCard(k.Team(id).Users())
+	}
+	if err != nil || size == 0 {
 		out.Encode(struct {
 			Error string
 		}{"Team not found: " + teamId})
 		return
 	}
 
-	teamPrefix := fmt.Sprintf("team:%v:", teamId)
+	teamKeys := k.Team(id)
 
-	health 		:= db.Redis.Get(teamPrefix + "health")
-	fill 		:= db.Redis.Get(teamPrefix + "fill")
-	capacity 	:= db.Redis.Get(teamPrefix + "capacity")
-	teamMembers := db.Redis.SMembers(teamPrefix + "users")
+	health, _ 		:= db.Client.Get(teamKeys.Health())
+	fill, _ 		:= db.Client.Get(teamKeys.Fill())
+	capacity, _ 	:= db.Client.Get(teamKeys.Capacity())
+	teamMembers, _ 	:= db.Client.SMembers(teamKeys.Users())
 
 	var users []string
-	for _, id := range teamMembers.Val() {
-		userIdKey := fmt.Sprintf("uid:%v:username", id)
-		fmt.Printf("[API:USERS]\t%v\n", id)
-		users = append(users, db.Redis.Get(userIdKey).Val())
+	for _, member := range teamMembers {
+		fmt.Printf("[API:USERS]\t%v\n", member)
+		userId, _ := strconv.Atoi(member)
+		name, _ := db.Client.Get(k.User(userId).Username())
+		users = append(users, name)
 	}
 	
 	fmt.Printf("[API:USERNAMES]\t%v\n", users)
@@ -41,7 +53,7 @@ func handleApiCollector(w http.ResponseWriter, r *http.Request) {
 		Capacity 	string 		`json:"cap"`
 		Team 		[]string 	`json:"team"`
 		Id 			string 		`json:"id"`
-	}{health.Val(), fill.Val(), capacity.Val(), users, teamId}
+	}{health, fill, capacity, users, teamId}
 
 	obj := struct {
 		Collector interface{} `json:"collector"`
@@ -54,15 +66,111 @@ func handleApiBadges(w http.ResponseWriter, r *http.Request) {
 	out := json.NewEncoder(w)
 
 	userId := r.FormValue("id")
-	badges := fmt.Sprintf("uid:%v:badges", userId)
-	badgeSet := db.Redis.SMembers(badges)
+	id, _ := strconv.Atoi(userId)
+	userKeys := keys.ForRoom(r.FormValue("room")).User(id)
+
+	badgeNames, _ := db.Client.SMembers(userKeys.Badges())
+	times, _ := db.Client.HGetAll(userKeys.BadgeTimes())
 
-	badgeNames := badgeSet.Val()
+	var earned []badges.Earned
+	for _, name := range badgeNames {
+		b, _ := badges.Get(name)
+		when, _ := strconv.ParseInt(times[name], 10, 64)
+		earned = append(earned, badges.Earned{Badge: b, Earned: when})
+	}
 
 	obj := struct {
 		UserId string `json:"id"`
 		Badges []string `json:"badges"`
-	}{userId, badgeNames}
+		Earned []badges.Earned `json:"earned"`
+	}{userId, badgeNames, earned}
+
+	out.Encode(obj)
+}
+
+// Every badge players can go after
+func handleApiBadgeCatalog(w http.ResponseWriter, r *http.Request) {
+	out := json.NewEncoder(w)
+
+	obj := struct {
+		Badges []badges.Badge `json:"badges"`
+	}{badges.Visible()}
+
+	out.Encode(obj)
+}
+
+// e.g. /api/v1/Leaderboard.json?board=users&offset=0&count=10
+//   or /api/v1/Leaderboard.json?board=teams&around=3&count=5
+func handleApiLeaderboard(w http.ResponseWriter, r *http.Request) {
+	out := json.NewEncoder(w)
+
+	k := keys.ForRoom(r.FormValue("room"))
+
+	board := r.FormValue("board")
+	if board == "" {
+		board = leaderboard.Users
+	}
+	if !leaderboard.IsBoard(board) {
+		out.Encode(struct {
+			Error string
+		}{"Leaderboard not found: " + board})
+		return
+	}
+
+	count, err := strconv.Atoi(r.FormValue("count"))
+	if err != nil || count < 1 || count > 100 {
+		count = 10
+	}
+
+	var entries []leaderboard.Entry
+
+	if around := r.FormValue("around"); around != "" {
+		id, _ := strconv.Atoi(around)
+		entries, err = leaderboard.Around(k, board, id, count)
+		if err != nil {
+			out.Encode(struct {
+				Error string
+			}{err.Error()})
+			return
+		}
+	} else {
+		offset, _ := strconv.Atoi(r.FormValue("offset"))
+		entries = leaderboard.Top(k, board, offset, count)
+	}
+
+	obj := struct {
+		Board 	string 				`json:"board"`
+		Total 	int 				`json:"total"`
+		Entries []leaderboard.Entry `json:"entries"`
+	}{board, leaderboard.Size(k, board), entries}
+
+	out.Encode(obj)
+}
+
+// e.g. /api/v1/Points.json?id=3&offset=0&count=20
+func handleApiPoints(w http.ResponseWriter, r *http.Request) {
+	out := json.NewEncoder(w)
+
+	k := keys.ForRoom(r.FormValue("room"))
+	userId, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		out.Encode(struct {
+			Error string
+		}{"User not found: " + r.FormValue("id")})
+		return
+	}
+
+	count, err := strconv.Atoi(r.FormValue("count"))
+	if err != nil || count < 1 || count > 100 {
+		count = 20
+	}
+	offset, _ := strconv.Atoi(r.FormValue("offset"))
+
+	obj := struct {
+		UserId 	int 			`json:"id"`
+		Total 	int 			`json:"total"`
+		History []ledger.Entry 	`json:"history"`
+	}{userId, ledger.Total(k, userId), ledger.History(k, userId, offset, count)}
 
 	out.Encode(obj)
 }
\ No newline at end of file
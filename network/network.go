@@ -4,8 +4,8 @@ import (
 	"bitbucket.org/jahfer/flux-middleman/client"
 	"bitbucket.org/jahfer/flux-middleman/events"
 	"bitbucket.org/jahfer/flux-middleman/db"
+	"bitbucket.org/jahfer/flux-middleman/keys"
 	"code.google.com/p/go.net/websocket"
-	r "github.com/vmihailenco/redis"
 	"net"
 	"net/http"
 	"fmt"
@@ -18,7 +18,14 @@ var TcpClients 	= client.NewHub() // xna
 // Create event manager for dispatches
 var Manager 	= events.NewManager()
 
+// Where phones and XNA connect; change them to run several servers
+// on one machine
+var HttpAddr = ":80"
+var TcpAddr = ":8100"
+
 var globalInit = make(chan bool, 3)
+// Closed once every background service is up
+var Ready = make(chan bool)
 
 // Boot cycle for servers
 func Init() {
@@ -37,9 +44,10 @@ func Init() {
 	go func() {
 		for _ = range globalInit {
 			count++;
-			if count >= 3 {
+			if count == 3 {
 				fmt.Println(" Initialization complete!")
 				fmt.Println("")
+				close(Ready)
 			}
 		}
 	}()
@@ -75,7 +83,7 @@ func tcpHandler(conn net.Conn) {
 
 // Start the HTTP/WS server to listen for new connections
 func initSocketServer() {
-	fmt.Println(" -- Initializing WebSocket server on :80")
+	fmt.Printf(" -- Initializing WebSocket server on %v\n", HttpAddr)
 
 	go WsClients.Run()
 
@@ -84,6 +92,9 @@ func initSocketServer() {
 	// serve api
 	http.HandleFunc("/api/v1/Collector.json", handleApiCollector)
 	http.HandleFunc("/api/v1/Badges.json", handleApiBadges)
+	http.HandleFunc("/api/v1/BadgeCatalog.json", handleApiBadgeCatalog)
+	http.HandleFunc("/api/v1/Leaderboard.json", handleApiLeaderboard)
+	http.HandleFunc("/api/v1/Points.json", handleApiPoints)
 	// endpoint for websocket connections
 	http.Handle("/ws", websocket.Handler(wsHandler))
 	// serve static files for Sencha
@@ -91,18 +102,18 @@ func initSocketServer() {
 
 	globalInit <- true
 
-	if err := http.ListenAndServe(":80", nil); err != nil {
+	if err := http.ListenAndServe(HttpAddr, nil); err != nil {
 		panic("ListenAndServe: " + err.Error())
 	}
 }
 
 // Start the TCP server and listen for new connections
 func initTcpServer() {
-	fmt.Println(" -- Initializing TCP server on :8100")
+	fmt.Printf(" -- Initializing TCP server on %v\n", TcpAddr)
 
 	go TcpClients.Run()
 
-	listener, err := net.Listen("tcp", ":8100")
+	listener, err := net.Listen("tcp", TcpAddr)
 	if err != nil {
 		panic(err.Error())
 	}
@@ -121,21 +132,27 @@ func initTcpServer() {
 }
 
 func initDb() {
-	fmt.Println(" -- Initializing Redis server on :6379")
+	if db.Client == nil {
+		fmt.Printf(" -- Initializing Redis server on %v\n", db.RedisOptions.Addr)
+	} else {
+		fmt.Println(" -- Initializing data store")
+	}
 
 	defer func() {
 		if r := recover(); r != nil {
-			fmt.Printf("[ERROR]\tRedis database connection not found.\n")
+			fmt.Printf("[ERROR]\tRedis database connection not found. %v\n", r)
 			os.Exit(1)
 		}
 	}()
 
 	db.Init()
 
-	_, err := db.Redis.Pipelined(func(c *r.PipelineClient) {
-	    db.Redis.Set("global:nextUserId", "0")
-	    db.Redis.Set("global:nextTeamId", "0")
-	})
+	k := keys.ForRoom("")
+	// left alone when resuming or keeping the last run's data
+	_, err := db.Client.SetNX(k.NextUserId(), "0")
+	if err == nil {
+		_, err = db.Client.SetNX(k.NextTeamId(), "0")
+	}
 
 	if err != nil {
 		fmt.Printf("[ERROR]\tCould not write to Redis database.\n")
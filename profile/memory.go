@@ -0,0 +1,62 @@
+package profile
+
+import (
+	"sort"
+	"sync"
+)
+
+type memoryStore struct {
+	mutex    sync.Mutex
+	profiles map[string]*memoryProfile
+}
+
+type memoryProfile struct {
+	points, games int
+	badges        map[string]bool
+}
+
+// Profiles kept in process, gone when the server stops; for tests and
+// trying things out without a database
+func NewMemory() Store {
+	return &memoryStore{profiles: make(map[string]*memoryProfile)}
+}
+
+func (m *memoryStore) Load(id string) (Profile, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	p := Profile{Id: id, Badges: []string{}}
+
+	if mp, ok := m.profiles[id]; ok {
+		p.Points, p.GamesPlayed = mp.points, mp.games
+		for badge := range mp.badges {
+			p.Badges = append(p.Badges, badge)
+		}
+		sort.Strings(p.Badges)
+	}
+
+	return p, nil
+}
+
+func (m *memoryStore) Add(p Profile) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	mp, ok := m.profiles[p.Id]
+	if !ok {
+		mp = &memoryProfile{badges: make(map[string]bool)}
+		m.profiles[p.Id] = mp
+	}
+
+	mp.points += p.Points
+	mp.games += p.GamesPlayed
+	for _, badge := range p.Badges {
+		mp.badges[badge] = true
+	}
+
+	return nil
+}
+
+func (m *memoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,152 @@
+package profile
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// What a player has built up over every game they've played
+type Profile struct {
+	// device or account id the phone sends on user:new
+	Id          string   `json:"id"`
+	Points      int      `json:"points"`
+	Badges      []string `json:"badges"`
+	GamesPlayed int      `json:"games_played"`
+}
+
+// Somewhere profiles outlive the game data
+type Store interface {
+	// Profile for the id; a new player gets an empty one
+	Load(id string) (Profile, error)
+	// Add the points, games and badges to the stored profile
+	Add(p Profile) error
+	Close() error
+}
+
+// Where profiles are kept; nil when they are switched off
+var Client Store
+
+// Returned by Start when another player is already using the id
+var ErrInUse = errors.New("Profile is in use by another player")
+
+// Ids held by live players in every room, so a phone can't pass itself
+// off as one that's still playing
+var claims = struct {
+	sync.Mutex
+	owners map[string]claim
+}{owners: make(map[string]claim)}
+
+type claim struct {
+	sessions *Sessions
+	userId   int
+}
+
+// Players in a room who have a profile, and how many of their points
+// have already been added to it
+type Sessions struct {
+	mutex sync.Mutex
+	// user id -> session
+	active map[int]*session
+}
+
+type session struct {
+	id    string
+	saved int
+}
+
+func NewSessions() *Sessions {
+	return &Sessions{active: make(map[int]*session)}
+}
+
+// Start tracking the player; points is their total so far, which a
+// resumed player has already been credited with. The id stays tied to
+// the player until End.
+func (s *Sessions) Start(userId int, id string, points int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	claims.Lock()
+	defer claims.Unlock()
+
+	me := claim{s, userId}
+	if owner, ok := claims.owners[id]; ok && owner != me {
+		return ErrInUse
+	}
+
+	if sess, ok := s.active[userId]; ok {
+		delete(claims.owners, sess.id)
+	}
+	claims.owners[id] = me
+	s.active[userId] = &session{id: id, saved: points}
+
+	return nil
+}
+
+// Everything the player has earned since the last call, given their
+// current points and badges. ok is false for players without a profile.
+func (s *Sessions) Take(userId, points, games int, badges []string) (p Profile, ok bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sess, ok := s.active[userId]
+	if !ok {
+		return
+	}
+
+	p = Profile{
+		Id:          sess.id,
+		Points:      points - sess.saved,
+		Badges:      append([]string{}, badges...),
+		GamesPlayed: games,
+	}
+	sort.Strings(p.Badges)
+	sess.saved = points
+
+	return p, true
+}
+
+// Points went back to zero for a new round; nothing from it has been
+// added to the profiles yet
+func (s *Sessions) ResetPoints() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, sess := range s.active {
+		sess.saved = 0
+	}
+}
+
+// Stop tracking the player, freeing their id
+func (s *Sessions) End(userId int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.end(userId)
+}
+
+// Stop tracking everyone, e.g. once the room is closed
+func (s *Sessions) EndAll() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for userId := range s.active {
+		s.end(userId)
+	}
+}
+
+// must be called with the mutex held
+func (s *Sessions) end(userId int) {
+	sess, ok := s.active[userId]
+	if !ok {
+		return
+	}
+
+	claims.Lock()
+	if claims.owners[sess.id] == (claim{s, userId}) {
+		delete(claims.owners, sess.id)
+	}
+	claims.Unlock()
+
+	delete(s.active, userId)
+}
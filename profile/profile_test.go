@@ -0,0 +1,95 @@
+package profile
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSessionsOnlyHandOutNewPoints(t *testing.T) {
+	s := NewSessions()
+
+	if _, ok := s.Take(1, 50, 0, nil); ok {
+		t.Errorf("Player without a profile was handed one")
+	}
+
+	// resumed with 20 points already credited
+	s.Start(1, "phone-a", 20)
+
+	p, ok := s.Take(1, 50, 1, []string{"sniper", "early-bird"})
+	if !ok || p.Id != "phone-a" || p.Points != 30 || p.GamesPlayed != 1 {
+		t.Errorf("Got %+v after the round", p)
+	}
+	if !reflect.DeepEqual(p.Badges, []string{"early-bird", "sniper"}) {
+		t.Errorf("Got badges %v", p.Badges)
+	}
+
+	if p, _ = s.Take(1, 55, 0, nil); p.Points != 5 {
+		t.Errorf("Got %v points on leaving, expected 5", p.Points)
+	}
+
+	s.End(1)
+	if _, ok := s.Take(1, 60, 0, nil); ok {
+		t.Errorf("Session survived End")
+	}
+}
+
+func TestMemoryStoreAddsUp(t *testing.T) {
+	m := NewMemory()
+
+	if p, _ := m.Load("phone-a"); p.Points != 0 || len(p.Badges) != 0 {
+		t.Errorf("New player started with %+v", p)
+	}
+
+	m.Add(Profile{Id: "phone-a", Points: 30, GamesPlayed: 1, Badges: []string{"sniper"}})
+	m.Add(Profile{Id: "phone-a", Points: 5, Badges: []string{"sniper", "early-bird"}})
+
+	p, _ := m.Load("phone-a")
+	want := Profile{Id: "phone-a", Points: 35, GamesPlayed: 1, Badges: []string{"early-bird", "sniper"}}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("Got %+v, expected %+v", p, want)
+	}
+}
+
+func TestIdsAreTiedToOnePlayer(t *testing.T) {
+	first, second := NewSessions(), NewSessions()
+
+	if err := first.Start(1, "phone-b", 0); err != nil {
+		t.Fatal(err)
+	}
+	// coming back to the same seat is fine
+	if err := first.Start(1, "phone-b", 0); err != nil {
+		t.Errorf("Player lost their own id. %v", err)
+	}
+
+	if err := first.Start(2, "phone-b", 0); err != ErrInUse {
+		t.Errorf("Another player took the id, got %v", err)
+	}
+	if err := second.Start(1, "phone-b", 0); err != ErrInUse {
+		t.Errorf("Player in another room took the id, got %v", err)
+	}
+
+	first.EndAll()
+	if err := second.Start(1, "phone-b", 0); err != nil {
+		t.Errorf("Id still held after the room closed. %v", err)
+	}
+	second.End(1)
+}
+
+func TestSessionsCarryOverRounds(t *testing.T) {
+	s := NewSessions()
+	s.Start(1, "phone-a", 0)
+
+	if p, _ := s.Take(1, 40, 1, nil); p.Points != 40 {
+		t.Errorf("Got %v points after the first round, expected 40", p.Points)
+	}
+
+	// next round starts from nothing
+	s.ResetPoints()
+
+	if p, _ := s.Take(1, 15, 1, nil); p.Points != 15 {
+		t.Errorf("Got %v points after the second round, expected 15", p.Points)
+	}
+	if p, _ := s.Take(1, 15, 0, nil); p.Points != 0 {
+		t.Errorf("Got %v points with nothing new, expected 0", p.Points)
+	}
+}
@@ -0,0 +1,121 @@
+package profile
+
+import (
+	"github.com/ziutek/mymysql/autorc"
+	"github.com/ziutek/mymysql/mysql"
+	// thread safe engine, as profiles are saved from several goroutines
+	_ "github.com/ziutek/mymysql/thrsafe"
+)
+
+// Where the MySQL database lives
+type SQLConfig struct {
+	Addr     string
+	User     string
+	Password string
+	Database string
+}
+
+// Connection settings for NewSQL, overridden from the command line.
+// A local database is enough, e.g.
+//
+//	mysql -u root -e 'CREATE DATABASE flux'
+//
+// the tables are created on connect.
+var SQLOptions = SQLConfig{
+	Addr:     "127.0.0.1:3306",
+	User:     "root",
+	Database: "flux",
+}
+
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS profiles (
+		id VARCHAR(64) NOT NULL PRIMARY KEY,
+		points INT NOT NULL DEFAULT 0,
+		games_played INT NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS profile_badges (
+		profile_id VARCHAR(64) NOT NULL,
+		badge VARCHAR(64) NOT NULL,
+		PRIMARY KEY (profile_id, badge)
+	)`,
+}
+
+type sqlStore struct {
+	conn *autorc.Conn
+
+	loadProfile, loadBadges *autorc.Stmt
+	addProfile, addBadge    *autorc.Stmt
+}
+
+// Profiles kept in MySQL. The connection is re-established whenever
+// it drops.
+func NewSQL(cfg SQLConfig) (Store, error) {
+	conn := autorc.New("tcp", "", cfg.Addr, cfg.User, cfg.Password, cfg.Database)
+
+	for _, sql := range schema {
+		if _, _, err := conn.Query(sql); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &sqlStore{conn: conn}
+
+	statements := []struct {
+		stmt **autorc.Stmt
+		sql  string
+	}{
+		{&s.loadProfile, "SELECT points, games_played FROM profiles WHERE id = ?"},
+		{&s.loadBadges, "SELECT badge FROM profile_badges WHERE profile_id = ? ORDER BY badge"},
+		{&s.addProfile, "INSERT INTO profiles (id, points, games_played) VALUES (?, ?, ?) " +
+			"ON DUPLICATE KEY UPDATE points = points + VALUES(points), games_played = games_played + VALUES(games_played)"},
+		{&s.addBadge, "INSERT IGNORE INTO profile_badges (profile_id, badge) VALUES (?, ?)"},
+	}
+
+	for _, st := range statements {
+		stmt, err := conn.Prepare(st.sql)
+		if err != nil {
+			return nil, err
+		}
+		*st.stmt = stmt
+	}
+
+	return s, nil
+}
+
+func (s *sqlStore) Load(id string) (Profile, error) {
+	p := Profile{Id: id, Badges: []string{}}
+
+	row, _, err := s.loadProfile.ExecFirst(id)
+	if err != nil || row == nil {
+		return p, err
+	}
+	p.Points, p.GamesPlayed = row.Int(0), row.Int(1)
+
+	var rows []mysql.Row
+	if rows, _, err = s.loadBadges.Exec(id); err != nil {
+		return p, err
+	}
+	for _, row := range rows {
+		p.Badges = append(p.Badges, row.Str(0))
+	}
+
+	return p, nil
+}
+
+func (s *sqlStore) Add(p Profile) error {
+	if _, _, err := s.addProfile.Exec(p.Id, p.Points, p.GamesPlayed); err != nil {
+		return err
+	}
+
+	for _, badge := range p.Badges {
+		if _, _, err := s.addBadge.Exec(p.Id, badge); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *sqlStore) Close() error {
+	return s.conn.Raw.Close()
+}
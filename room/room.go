@@ -0,0 +1,268 @@
+package room
+
+import (
+	"bitbucket.org/jahfer/flux-middleman/achievements"
+	"bitbucket.org/jahfer/flux-middleman/client"
+	"bitbucket.org/jahfer/flux-middleman/cluster"
+	"bitbucket.org/jahfer/flux-middleman/cooldown"
+	"bitbucket.org/jahfer/flux-middleman/db"
+	"bitbucket.org/jahfer/flux-middleman/game"
+	"bitbucket.org/jahfer/flux-middleman/helper"
+	"bitbucket.org/jahfer/flux-middleman/input"
+	"bitbucket.org/jahfer/flux-middleman/network"
+	"bitbucket.org/jahfer/flux-middleman/profile"
+	"bitbucket.org/jahfer/flux-middleman/team"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Room anybody lands in when they don't ask for one
+const DefaultCode = ""
+
+// Letters used for join codes; no I or O to keep them readable
+const codeLetters = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+const codeLength = 4
+
+// A self-contained game with its own teams, round and displays
+type Room struct {
+	Code    string
+	Scope   helper.Scope
+	Teams   *team.Manager
+	Session *game.Session
+	// nil when touches go straight to the display
+	Touches *input.Aggregator
+	Screens *input.Mapper
+	// nil leaves attacks, shots and bloats unchecked
+	Cooldowns *cooldown.Tracker
+	// players whose lifetime profile is being kept
+	Profiles *profile.Sessions
+	// set once the room has been shut
+	closed bool
+}
+
+var (
+	mutex sync.Mutex
+	rooms = make(map[string]*Room)
+	// which room each connection has joined
+	members = make(map[io.Writer]*Room)
+	// connections that are only watching
+	spectators = make(map[io.Writer]bool)
+	// connections told the round isn't under way since it last changed
+	told = make(map[io.Writer]*Room)
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// Set up a room under the given code and start its team manager
+func New(code string, session *game.Session) *Room {
+	scope := helper.NewScope(code)
+	teams := team.NewManager(scope)
+
+	r := &Room{
+		Code:     code,
+		Scope:    teams.Scope,
+		Teams:    &teams,
+		Session:  session,
+		Screens:  input.NewMapper(),
+		Profiles: profile.NewSessions(),
+	}
+
+	mutex.Lock()
+	rooms[code] = r
+	mutex.Unlock()
+
+	go r.Teams.Run()
+
+	return r
+}
+
+// Generate a join code nobody is using yet
+func NewCode() string {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for {
+		b := make([]byte, codeLength)
+		for i := range b {
+			b[i] = codeLetters[rand.Intn(len(codeLetters))]
+		}
+
+		if _, taken := rooms[string(b)]; !taken {
+			return string(b)
+		}
+	}
+}
+
+func Get(code string) (*Room, bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	r, ok := rooms[code]
+	return r, ok
+}
+
+func All() (all []*Room) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for _, r := range rooms {
+		all = append(all, r)
+	}
+	return
+}
+
+// Shut a room; the default room always stays open. Its phones and
+// displays stay attached to it, so their events are turned away rather
+// than landing in the default room. Reports whether the room was open
+// until now.
+func Close(code string) bool {
+	if code == DefaultCode {
+		return false
+	}
+
+	mutex.Lock()
+	r, open := rooms[code]
+	if open {
+		delete(rooms, code)
+		r.closed = true
+	}
+	mutex.Unlock()
+
+	if open {
+		r.Close()
+	}
+	return open
+}
+
+// Stop everything running for the room and clear out its keys
+func (r *Room) Close() {
+	r.Teams.Stop()
+	r.Session.Stop()
+	if r.Touches != nil {
+		r.Touches.Stop()
+	}
+
+	achievements.Default.ForgetRoom(r.Scope)
+	r.Profiles.EndAll()
+
+	if _, err := db.Clear(r.Scope.Keys.Pattern()); err != nil {
+		fmt.Printf("[ERROR]\tCould not clear the keys of room %q. %v\n", r.Code, err)
+	}
+}
+
+func (r *Room) IsClosed() bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	return r.closed
+}
+
+// Room the connection has joined, or the default room. The room may
+// have been closed since.
+func ForConn(conn io.Writer) *Room {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if r, ok := members[conn]; ok {
+		return r
+	}
+	return rooms[DefaultCode]
+}
+
+// Move a phone or display into the room
+func Attach(conn io.Writer, r *Room) {
+	mutex.Lock()
+	members[conn] = r
+	delete(spectators, conn)
+	mutex.Unlock()
+
+	join(conn, r.Code)
+}
+
+// Let a connection watch the room without joining a team
+func AttachSpectator(conn io.Writer, r *Room) {
+	mutex.Lock()
+	members[conn] = r
+	spectators[conn] = true
+	mutex.Unlock()
+
+	join(conn, helper.SpectatorChannel(r.Code))
+}
+
+func join(conn io.Writer, channel string) {
+	// phones on another server in the cluster join there
+	if remote, ok := conn.(*cluster.Remote); ok {
+		remote.Join(channel)
+		return
+	}
+
+	if c, ok := conn.(client.Client); ok {
+		m := client.Membership{Client: c, Room: channel}
+		switch c.(type) {
+		case *client.TcpClient:
+			network.TcpClients.Join <- m
+		case *client.WebSocketClient:
+			network.WsClients.Join <- m
+		}
+	}
+}
+
+func IsSpectator(conn io.Writer) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	return spectators[conn]
+}
+
+func (r *Room) NumSpectators() (count int) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for conn := range spectators {
+		if members[conn] == r {
+			count++
+		}
+	}
+	return
+}
+
+// Forget a connection that has gone away
+func Detach(conn io.Writer) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	delete(members, conn)
+	delete(spectators, conn)
+	delete(told, conn)
+}
+
+// Reports whether the connection has yet to hear the round isn't under
+// way, counting it as told from now on. Keeps a phone sending events
+// out of turn from being answered for every one of them.
+func (r *Room) Tell(conn io.Writer) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if told[conn] == r {
+		return false
+	}
+	told[conn] = r
+	return true
+}
+
+// The round has moved on; everyone has to be told again
+func (r *Room) Untell() {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for conn, room := range told {
+		if room == r {
+			delete(told, conn)
+		}
+	}
+}
@@ -94,12 +94,15 @@ func matchMapToStruct(datamap map[string] string, v interface{}) (err error) {
 		if d, ok := datamap[fieldname]; ok {
 			switch st.Field(i).Kind() {
 			default:
-				return errors.New("Unsupported type in interface{} (not int or string)")
+				return errors.New("Unsupported type in interface{} (not int, float or string)")
 			case reflect.String:
 				st.Field(i).SetString(d)
 			case reflect.Int:
 				digit, _ := strconv.Atoi(d)
 				st.Field(i).SetInt(int64(digit))
+			case reflect.Float64:
+				f, _ := strconv.ParseFloat(d, 64)
+				st.Field(i).SetFloat(f)
 			}
 		} else {
 			return errors.New("Did not fulfill all members of structure")
@@ -1,33 +1,271 @@
 package team
 
 import (
+	"errors"
+	"fmt"
 	"image/color"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
 )
 
-var colorQueue chan color.Color = make(chan color.Color, 15)
-var activeColors chan color.Color = make(chan color.Color, 15)
+// Colors handed out before any extras need to be generated
+var DefaultPalette = []color.Color{
+	color.RGBA{255, 0, 0, 255},
+	color.RGBA{0, 255, 0, 255},
+	color.RGBA{0, 0, 255, 255},
+	color.RGBA{255, 255, 255, 255},
+}
+
+// Hands out a unique color to each live team, and takes it back
+// once the team has been destroyed
+type ColorPool struct {
+	mutex   sync.Mutex
+	palette []color.Color
+	free    []color.Color
+	active  map[int]color.Color
+	// position in the generated hue sequence
+	seq int
+}
+
+func NewColorPool(palette []color.Color) *ColorPool {
+	p := &ColorPool{active: make(map[int]color.Color)}
+	p.SetPalette(palette)
+	return p
+}
+
+// Replace the base palette; colors currently held by teams are kept
+func (p *ColorPool) SetPalette(palette []color.Color) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.palette = append([]color.Color{}, palette...)
+	p.free = p.free[:0]
+
+	for _, c := range p.palette {
+		if !p.inUse(c) {
+			p.free = append(p.free, c)
+		}
+	}
+}
+
+// Reserve a color for the team, reusing its current one if it has any
+func (p *ColorPool) Acquire(teamId int) color.Color {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
 
-var initialized bool = false
+	if c, ok := p.active[teamId]; ok {
+		return c
+	}
+
+	var c color.Color
+	if len(p.free) > 0 {
+		c = p.free[0]
+		p.free = p.free[1:]
+	} else {
+		c = p.generate()
+	}
 
-func Init() {
-	colorQueue <- color.RGBA{255,0,0,255}
-	colorQueue <- color.RGBA{0,255,0,255}
-	colorQueue <- color.RGBA{0,0,255,255}
-	colorQueue <- color.RGBA{255,255,255,255}
+	p.active[teamId] = c
+	return c
+}
+
+// Hand a specific color to a team, e.g. when restoring a saved game
+func (p *ColorPool) Assign(teamId int, c color.Color) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for i, f := range p.free {
+		if sameColor(f, c) {
+			p.free = append(p.free[:i], p.free[i+1:]...)
+			break
+		}
+	}
 
-	initialized = true
+	p.active[teamId] = c
 }
 
-func GetNextColor() (col color.Color) {
-	if initialized == false { Init() }
+// Return the team's color to the pool
+func (p *ColorPool) Release(teamId int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
 
-	select {
-	case c := <-colorQueue:
-		activeColors <- c
-		col = c
-	default:
-		col = color.Black
+	c, ok := p.active[teamId]
+	if !ok {
+		return
 	}
+	delete(p.active, teamId)
 
+	// generated colors are thrown away, palette colors go back in line
+	for _, pc := range p.palette {
+		if sameColor(pc, c) {
+			p.free = append(p.free, c)
+			return
+		}
+	}
+}
+
+// Color currently assigned to the team
+func (p *ColorPool) Get(teamId int) (c color.Color, ok bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	c, ok = p.active[teamId]
 	return
-}
\ No newline at end of file
+}
+
+func (p *ColorPool) inUse(c color.Color) bool {
+	for _, a := range p.active {
+		if sameColor(a, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// Walk the hue wheel by the golden angle and keep whichever candidate
+// sits furthest (in Lab space) from every color already on screen
+func (p *ColorPool) generate() color.Color {
+	const candidates = 24
+
+	var best color.Color
+	bestDist := -1.0
+
+	for i := 0; i < candidates; i++ {
+		p.seq++
+		c := sequenceColor(p.seq)
+
+		dist := math.MaxFloat64
+		for _, a := range p.active {
+			if d := deltaE(c, a); d < dist {
+				dist = d
+			}
+		}
+
+		if dist > bestDist {
+			best, bestDist = c, dist
+		}
+	}
+
+	return best
+}
+
+func sequenceColor(n int) color.Color {
+	const goldenRatio = 0.618033988749895
+
+	hue := math.Mod(float64(n)*goldenRatio, 1)
+	// alternate brightness so neighbouring hues stay apart
+	light := 0.45 + 0.15*float64(n%3)/2
+
+	return hslToRGB(hue, 0.85, light)
+}
+
+func hslToRGB(h, s, l float64) color.RGBA {
+	var q float64
+	if l < 0.5 {
+		q = l * (1 + s)
+	} else {
+		q = l + s - l*s
+	}
+	p := 2*l - q
+
+	channel := func(t float64) uint8 {
+		t = math.Mod(t+1, 1)
+		var v float64
+		switch {
+		case t < 1.0/6:
+			v = p + (q-p)*6*t
+		case t < 1.0/2:
+			v = q
+		case t < 2.0/3:
+			v = p + (q-p)*(2.0/3-t)*6
+		default:
+			v = p
+		}
+		return uint8(math.Floor(v*255 + 0.5))
+	}
+
+	return color.RGBA{channel(h + 1.0/3), channel(h), channel(h - 1.0/3), 255}
+}
+
+// CIE76 colour difference
+func deltaE(a, b color.Color) float64 {
+	l1, a1, b1 := toLab(a)
+	l2, a2, b2 := toLab(b)
+	return math.Sqrt((l1-l2)*(l1-l2) + (a1-a2)*(a1-a2) + (b1-b2)*(b1-b2))
+}
+
+func toLab(c color.Color) (l, a, b float64) {
+	r, g, bl, _ := c.RGBA()
+
+	linear := func(v uint32) float64 {
+		f := float64(v) / 0xffff
+		if f <= 0.04045 {
+			return f / 12.92
+		}
+		return math.Pow((f+0.055)/1.055, 2.4)
+	}
+	lr, lg, lb := linear(r), linear(g), linear(bl)
+
+	// sRGB -> XYZ (D65), normalized by the reference white
+	x := (0.4124*lr + 0.3576*lg + 0.1805*lb) / 0.95047
+	y := 0.2126*lr + 0.7152*lg + 0.0722*lb
+	z := (0.0193*lr + 0.1192*lg + 0.9505*lb) / 1.08883
+
+	f := func(t float64) float64 {
+		if t > 0.008856 {
+			return math.Cbrt(t)
+		}
+		return 7.787*t + 16.0/116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
+
+func sameColor(a, b color.Color) bool {
+	r1, g1, b1, a1 := a.RGBA()
+	r2, g2, b2, a2 := b.RGBA()
+	return r1 == r2 && g1 == g2 && b1 == b2 && a1 == a2
+}
+
+// Parse a comma-separated list of colors such as "#FF0000,#00FF00"
+func ParsePalette(s string) ([]color.Color, error) {
+	var palette []color.Color
+
+	for _, hex := range strings.Split(s, ",") {
+		hex = strings.TrimSpace(hex)
+		if hex == "" {
+			continue
+		}
+		c, err := ParseHexColor(hex)
+		if err != nil {
+			return nil, err
+		}
+		palette = append(palette, c)
+	}
+
+	return palette, nil
+}
+
+// Parse a color in the #RRGGBB format XNA reports in collector:heartbeat
+func ParseHexColor(s string) (color.RGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return color.RGBA{}, errors.New("Invalid color: " + s)
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.RGBA{}, errors.New("Invalid color: " + s)
+	}
+
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255}, nil
+}
+
+// Format a color as #RRGGBB
+func FormatHexColor(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02X%02X%02X", r>>8, g>>8, b>>8)
+}
@@ -0,0 +1,55 @@
+package team
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestColorPoolReusesReleasedColors(t *testing.T) {
+	p := NewColorPool(DefaultPalette)
+
+	for i := 0; i < len(DefaultPalette); i++ {
+		if c := p.Acquire(i); !sameColor(c, DefaultPalette[i]) {
+			t.Errorf("Team %v got %v, expected %v", i, c, DefaultPalette[i])
+		}
+	}
+
+	p.Release(1)
+
+	if c := p.Acquire(10); !sameColor(c, DefaultPalette[1]) {
+		t.Errorf("Released color was not reused, got %v", c)
+	}
+}
+
+func TestColorPoolGeneratesDistinctColors(t *testing.T) {
+	p := NewColorPool(DefaultPalette)
+
+	var used []color.Color
+	for i := 0; i < 16; i++ {
+		c := p.Acquire(i)
+		if sameColor(c, color.Black) {
+			t.Fatalf("Team %v fell back to black", i)
+		}
+		for _, u := range used {
+			if deltaE(c, u) < 10 {
+				t.Errorf("Team %v color %v too close to %v", i, c, u)
+			}
+		}
+		used = append(used, c)
+	}
+}
+
+func TestParsePalette(t *testing.T) {
+	colors, err := ParsePalette("#FF0000, #00ff00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(colors) != 2 || !sameColor(colors[1], color.RGBA{0, 255, 0, 255}) {
+		t.Errorf("Unexpected palette: %v", colors)
+	}
+
+	if _, err := ParsePalette("#FF00"); err == nil {
+		t.Errorf("Expected error for short color")
+	}
+}
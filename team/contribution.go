@@ -0,0 +1,141 @@
+package team
+
+import (
+	"sync"
+	"time"
+)
+
+// Things a player can do to help their collector
+type Action int
+
+const (
+	Touch Action = iota
+	Pinch
+	Bloat
+	Shot
+)
+
+// What a member has done since joining their current team
+type Contribution struct {
+	Touches int       `json:"touches"`
+	Pinches int       `json:"pinches"`
+	Bloats  int       `json:"bloats"`
+	Shots   int       `json:"shots"`
+	Joined  time.Time `json:"joined"`
+}
+
+// How much each action is worth when splitting points
+type Weights struct {
+	Touch  float64
+	Pinch  float64
+	Bloat  float64
+	Shot   float64
+	Second float64
+}
+
+var DefaultWeights = Weights{
+	Touch:  1,
+	Pinch:  2,
+	Bloat:  2,
+	Shot:   3,
+	Second: 0.1,
+}
+
+func (c Contribution) Score(w Weights, now time.Time) float64 {
+	score := w.Touch*float64(c.Touches) +
+		w.Pinch*float64(c.Pinches) +
+		w.Bloat*float64(c.Bloats) +
+		w.Shot*float64(c.Shots)
+
+	if !c.Joined.IsZero() {
+		score += w.Second * now.Sub(c.Joined).Seconds()
+	}
+
+	return score
+}
+
+// Tracks every member's contribution for a manager
+type Contributions struct {
+	mutex  sync.Mutex
+	byUser map[int]*Contribution
+}
+
+func NewContributions() *Contributions {
+	return &Contributions{byUser: make(map[int]*Contribution)}
+}
+
+// Start a member over on a new team
+func (c *Contributions) Join(userId int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.byUser[userId] = &Contribution{Joined: time.Now()}
+}
+
+func (c *Contributions) Forget(userId int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.byUser, userId)
+}
+
+func (c *Contributions) Record(userId int, a Action) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	con, ok := c.byUser[userId]
+	if !ok {
+		con = &Contribution{Joined: time.Now()}
+		c.byUser[userId] = con
+	}
+
+	switch a {
+	case Touch:
+		con.Touches++
+	case Pinch:
+		con.Pinches++
+	case Bloat:
+		con.Bloats++
+	case Shot:
+		con.Shots++
+	}
+}
+
+func (c *Contributions) Get(userId int) Contribution {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if con, ok := c.byUser[userId]; ok {
+		return *con
+	}
+	return Contribution{}
+}
+
+// Share out a collector's points between its members using the
+// manager's split strategy, then start everyone's tally over
+func (t Manager) Distribute(teamId, points int) map[int]int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	team := t.Roster[teamId]
+	now := time.Now()
+
+	scores := make([]float64, len(team))
+	for i, member := range team {
+		scores[i] = t.Contributions.Get(member.User.Id).Score(DefaultWeights, now)
+	}
+
+	split := t.Split
+	if split == nil {
+		split = SplitEqual
+	}
+
+	shares := make(map[int]int, len(team))
+	for i, pts := range split(points, scores) {
+		userId := team[i].User.Id
+		shares[userId] = pts
+		t.Contributions.Join(userId)
+	}
+
+	return shares
+}
@@ -0,0 +1,47 @@
+package team
+
+import (
+	"bitbucket.org/jahfer/flux-middleman/db"
+)
+
+type MemberOverview struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// What the scoreboard needs to draw a collector
+type TeamOverview struct {
+	Id       int              `json:"id"`
+	Color    string           `json:"color"`
+	Health   int              `json:"health"`
+	Fill     int              `json:"fill"`
+	Capacity int              `json:"cap"`
+	Members  []MemberOverview `json:"members"`
+}
+
+// Every live team, with the collector state last reported by XNA
+func (t Manager) Overview() (teams []TeamOverview) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for teamId, team := range t.Roster {
+		teamKeys := t.Scope.Keys.Team(teamId)
+
+		o := TeamOverview{Id: teamId}
+		o.Health = db.GetInt(teamKeys.Health())
+		o.Fill = db.GetInt(teamKeys.Fill())
+		o.Capacity = db.GetInt(teamKeys.Capacity())
+
+		if c, ok := t.Colors.Get(teamId); ok {
+			o.Color = FormatHexColor(c)
+		}
+
+		for _, member := range team {
+			o.Members = append(o.Members, MemberOverview{member.User.Id, member.User.Name})
+		}
+
+		teams = append(teams, o)
+	}
+
+	return
+}
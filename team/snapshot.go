@@ -0,0 +1,177 @@
+package team
+
+import (
+	"bitbucket.org/jahfer/flux-middleman/db"
+	"bitbucket.org/jahfer/flux-middleman/ledger"
+	"bitbucket.org/jahfer/flux-middleman/user"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// How long restored players have to reconnect before they are dropped
+var ResumeGrace = 60 * time.Second
+
+type SnapshotMember struct {
+	User       user.User         `json:"user"`
+	Points     int               `json:"points"`
+	Badges     []string          `json:"badges"`
+	BadgeTimes map[string]string `json:"badgeTimes"`
+	Ledger     []ledger.Entry    `json:"ledger"`
+}
+
+type SnapshotTeam struct {
+	Id      int              `json:"id"`
+	Color   string           `json:"color"`
+	Members []SnapshotMember `json:"members"`
+}
+
+type Snapshot struct {
+	Saved      int64          `json:"saved"`
+	NextUserId int            `json:"nextUserId"`
+	NextTeamId int            `json:"nextTeamId"`
+	Teams      []SnapshotTeam `json:"teams"`
+}
+
+// Stand-in connection for restored members who haven't reconnected yet
+type detachedConn struct {
+	userId int
+}
+
+func (c detachedConn) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// Write the current roster, colors, points and badges to the store
+func (t Manager) Save() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	snap := Snapshot{Saved: time.Now().Unix()}
+
+	snap.NextUserId = db.GetInt(t.Scope.Keys.NextUserId())
+	snap.NextTeamId = db.GetInt(t.Scope.Keys.NextTeamId())
+
+	for teamId, team := range t.Roster {
+		st := SnapshotTeam{Id: teamId}
+		if c, ok := t.Colors.Get(teamId); ok {
+			st.Color = FormatHexColor(c)
+		}
+
+		for _, member := range team {
+			userKeys := t.Scope.Keys.User(member.User.Id)
+			points := ledger.Total(t.Scope.Keys, member.User.Id)
+			history := ledger.History(t.Scope.Keys, member.User.Id, 0, ledger.MaxEntries)
+			badges, _ := db.Client.SMembers(userKeys.Badges())
+			badgeTimes, _ := db.Client.HGetAll(userKeys.BadgeTimes())
+
+			st.Members = append(st.Members, SnapshotMember{member.User, points, badges, badgeTimes, history})
+		}
+
+		snap.Teams = append(snap.Teams, st)
+	}
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	return db.Client.Set(t.Scope.Keys.Snapshot(), string(data))
+}
+
+// Load the last snapshot back into the roster. Restored members keep
+// their seat until ResumeGrace runs out or they reconnect.
+func (t *Manager) Restore() (restored int, err error) {
+	data, err := db.Client.Get(t.Scope.Keys.Snapshot())
+	if err != nil {
+		return
+	}
+
+	snap := Snapshot{}
+	if err = json.Unmarshal([]byte(data), &snap); err != nil {
+		return
+	}
+
+	// players may have joined since the server came up; only move the
+	// counters forward so their ids aren't handed out again
+	db.RaiseTo(t.Scope.Keys.NextUserId(), snap.NextUserId)
+	db.RaiseTo(t.Scope.Keys.NextTeamId(), snap.NextTeamId)
+
+	expires := float64(time.Now().Add(ResumeGrace).Unix())
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, st := range snap.Teams {
+		if c, err := ParseHexColor(st.Color); err == nil {
+			t.Colors.Assign(st.Id, c)
+		}
+
+		teamKey := t.Scope.Keys.Team(st.Id).Users()
+
+		for _, sm := range st.Members {
+			u := sm.User
+			u.TeamId = st.Id
+			u.Points = sm.Points
+
+			t.Roster[st.Id] = append(t.Roster[st.Id], Member{User: u, Conn: detachedConn{u.Id}})
+
+			idStr := strconv.Itoa(u.Id)
+			userKeys := t.Scope.Keys.User(u.Id)
+
+			db.Client.Set(t.Scope.Keys.Username(u.Name), idStr)
+			db.Client.Set(userKeys.Username(), u.Name)
+			db.Client.Set(userKeys.Team(), strconv.Itoa(st.Id))
+			ledger.Restore(t.Scope.Keys, u.Id, sm.Points, sm.Ledger)
+			if len(sm.Badges) > 0 {
+				db.Client.SAdd(userKeys.Badges(), sm.Badges...)
+			}
+			for badge, earned := range sm.BadgeTimes {
+				db.Client.HSet(userKeys.BadgeTimes(), badge, earned)
+			}
+			db.Client.SAdd(teamKey, idStr)
+			db.Client.ZAdd(t.Scope.Keys.Clients(), expires, idStr)
+
+			restored++
+		}
+	}
+
+	return
+}
+
+// Hand a restored player's seat back to them. The name has to match the
+// one saved alongside the id.
+func (t *Manager) Reattach(u user.User, conn io.Writer) (user.User, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for teamId, team := range t.Roster {
+		detached := 0
+		index := -1
+
+		for i, member := range team {
+			if _, ok := member.Conn.(detachedConn); ok {
+				detached++
+				if member.User.Id == u.Id && member.User.Name == u.Name {
+					index = i
+				}
+			}
+		}
+
+		if index == -1 {
+			continue
+		}
+
+		// first one back brings the collector with them
+		if detached == len(team) {
+			t.announceTeam(teamId, t.Colors.Acquire(teamId))
+		}
+
+		team[index].Conn = conn
+
+		return team[index].User, true
+	}
+
+	return u, false
+}
@@ -0,0 +1,90 @@
+package team
+
+import (
+	"bitbucket.org/jahfer/flux-middleman/db"
+	"bitbucket.org/jahfer/flux-middleman/helper"
+	"bitbucket.org/jahfer/flux-middleman/network"
+	"bitbucket.org/jahfer/flux-middleman/user"
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+func init() {
+	// announcements go out to the displays
+	go network.TcpClients.Run()
+}
+
+// Run with -race: saving used to read the roster while players joined
+// and left
+func TestSaveWhilePlayersComeAndGo(t *testing.T) {
+	db.Client = db.NewMemory()
+	m := NewManager(helper.NewScope(""))
+	go m.Run()
+	defer m.Stop()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 20; i++ {
+			conn := &bytes.Buffer{}
+			m.Queue <- Member{User: user.User{Id: i}, Conn: conn}
+			<-m.LastId
+			if i%2 == 0 {
+				m.Unregister <- conn
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if err := m.Save(); err != nil {
+				t.Error(err)
+			}
+			m.Reattach(user.User{Id: i}, &bytes.Buffer{})
+		}
+	}()
+
+	wg.Wait()
+
+	// players are dropped in the background; let them go before the
+	// next test swaps the store
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		if m.NumUsers() == 10 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Errorf("Players never finished leaving")
+}
+
+func TestRestoreOnlyRaisesCounters(t *testing.T) {
+	db.Client = db.NewMemory()
+	m := NewManager(helper.NewScope(""))
+	k := m.Scope.Keys
+
+	db.Client.Set(k.NextUserId(), "5")
+	db.Client.Set(k.NextTeamId(), "2")
+	if err := m.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// players came in before the snapshot was loaded
+	db.Client.Set(k.NextUserId(), "9")
+	db.Client.Set(k.NextTeamId(), "1")
+
+	if _, err := m.Restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	if id := db.GetInt(k.NextUserId()); id != 9 {
+		t.Errorf("Restore moved the user id counter back to %d", id)
+	}
+	if id := db.GetInt(k.NextTeamId()); id != 2 {
+		t.Errorf("Restore left the team id counter at %d, expected 2", id)
+	}
+}
@@ -0,0 +1,113 @@
+package team
+
+import (
+	"math"
+	"sort"
+)
+
+// Divides points between members given each one's contribution score.
+// The shares always add up to the points handed in.
+type SplitStrategy func(points int, scores []float64) []int
+
+// Available strategies by name
+var Splits = map[string]SplitStrategy{
+	"equal":        SplitEqual,
+	"proportional": SplitProportional,
+	"hybrid":       SplitHybrid,
+}
+
+// Portion of the pot SplitHybrid shares out evenly
+var HybridEqualShare = 0.5
+
+// Same amount for everybody; leftover points go to the most active
+func SplitEqual(points int, scores []float64) []int {
+	n := len(scores)
+	if n == 0 {
+		return nil
+	}
+
+	equal := make([]float64, n)
+	for i := range equal {
+		equal[i] = 1
+	}
+
+	return apportion(points, equal, scores)
+}
+
+// Points in proportion to what each member did
+func SplitProportional(points int, scores []float64) []int {
+	total := 0.0
+	for _, s := range scores {
+		total += s
+	}
+
+	// nobody did anything; fall back to even shares
+	if total <= 0 {
+		return SplitEqual(points, scores)
+	}
+
+	return apportion(points, scores, scores)
+}
+
+// A guaranteed base for everybody, the rest by contribution
+func SplitHybrid(points int, scores []float64) []int {
+	base := int(math.Floor(float64(points) * HybridEqualShare))
+
+	shares := SplitEqual(base, scores)
+	for i, extra := range SplitProportional(points-base, scores) {
+		shares[i] += extra
+	}
+
+	return shares
+}
+
+// Largest remainder method: floor every quota, then hand the leftover
+// points out by largest fraction, breaking ties by contribution
+func apportion(points int, weights, scores []float64) []int {
+	n := len(weights)
+	shares := make([]int, n)
+	if n == 0 {
+		return shares
+	}
+
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+
+	order := make(byLeftover, n)
+
+	given := 0
+	for i, w := range weights {
+		quota := float64(points) * w / total
+		shares[i] = int(math.Floor(quota))
+		given += shares[i]
+		order[i] = leftover{i, quota - math.Floor(quota), scores[i]}
+	}
+
+	sort.Stable(order)
+
+	for i := 0; given < points; i++ {
+		shares[order[i%n].index]++
+		given++
+	}
+
+	return shares
+}
+
+type leftover struct {
+	index    int
+	fraction float64
+	score    float64
+}
+
+type byLeftover []leftover
+
+func (l byLeftover) Len() int      { return len(l) }
+func (l byLeftover) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l byLeftover) Less(i, j int) bool {
+	if l[i].fraction != l[j].fraction {
+		return l[i].fraction > l[j].fraction
+	}
+	return l[i].score > l[j].score
+}
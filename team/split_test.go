@@ -0,0 +1,57 @@
+package team
+
+import (
+	"reflect"
+	"testing"
+)
+
+func sum(shares []int) (total int) {
+	for _, s := range shares {
+		total += s
+	}
+	return
+}
+
+func TestSplitEqualGivesRemainderToMostActive(t *testing.T) {
+	shares := SplitEqual(10, []float64{1, 5, 3})
+
+	if expected := []int{3, 4, 3}; !reflect.DeepEqual(shares, expected) {
+		t.Errorf("Got %v, expected %v", shares, expected)
+	}
+}
+
+func TestSplitProportional(t *testing.T) {
+	shares := SplitProportional(100, []float64{1, 1, 2})
+
+	if expected := []int{25, 25, 50}; !reflect.DeepEqual(shares, expected) {
+		t.Errorf("Got %v, expected %v", shares, expected)
+	}
+}
+
+func TestSplitProportionalWithoutContributions(t *testing.T) {
+	shares := SplitProportional(9, []float64{0, 0, 0})
+
+	if expected := []int{3, 3, 3}; !reflect.DeepEqual(shares, expected) {
+		t.Errorf("Got %v, expected %v", shares, expected)
+	}
+}
+
+func TestSplitHybrid(t *testing.T) {
+	shares := SplitHybrid(100, []float64{0, 1})
+
+	if expected := []int{25, 75}; !reflect.DeepEqual(shares, expected) {
+		t.Errorf("Got %v, expected %v", shares, expected)
+	}
+}
+
+func TestSplitsKeepEveryPoint(t *testing.T) {
+	scores := []float64{0.3, 7, 2.2, 0, 11}
+
+	for name, split := range Splits {
+		for points := 0; points < 50; points++ {
+			if got := sum(split(points, scores)); got != points {
+				t.Errorf("%v split of %v handed out %v", name, points, got)
+			}
+		}
+	}
+}
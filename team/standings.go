@@ -0,0 +1,102 @@
+package team
+
+import (
+	"bitbucket.org/jahfer/flux-middleman/leaderboard"
+	"bitbucket.org/jahfer/flux-middleman/ledger"
+	"sort"
+)
+
+type PlayerStanding struct {
+	Id     int    `json:"id"`
+	Name   string `json:"name"`
+	TeamId int    `json:"team_id"`
+	Points int    `json:"points"`
+}
+
+type TeamStanding struct {
+	Id      int              `json:"id"`
+	Points  int              `json:"points"`
+	Members []PlayerStanding `json:"members"`
+}
+
+type Standings struct {
+	Players []PlayerStanding `json:"players"`
+	Teams   []TeamStanding   `json:"teams"`
+}
+
+type byPlayerPoints []PlayerStanding
+
+func (s byPlayerPoints) Len() int           { return len(s) }
+func (s byPlayerPoints) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byPlayerPoints) Less(i, j int) bool { return s[i].Points > s[j].Points }
+
+type byTeamPoints []TeamStanding
+
+func (s byTeamPoints) Len() int           { return len(s) }
+func (s byTeamPoints) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byTeamPoints) Less(i, j int) bool { return s[i].Points > s[j].Points }
+
+// Rank every player and team by the points they've collected
+func (t Manager) Standings() (s Standings) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for teamId, team := range t.Roster {
+		ts := TeamStanding{Id: teamId}
+
+		for _, member := range team {
+			points := ledger.Total(t.Scope.Keys, member.User.Id)
+
+			ps := PlayerStanding{member.User.Id, member.User.Name, teamId, points}
+			ts.Members = append(ts.Members, ps)
+			ts.Points += points
+			s.Players = append(s.Players, ps)
+		}
+
+		sort.Sort(byPlayerPoints(ts.Members))
+		s.Teams = append(s.Teams, ts)
+	}
+
+	sort.Sort(byPlayerPoints(s.Players))
+	sort.Sort(byTeamPoints(s.Teams))
+
+	return
+}
+
+// Rebuild the team leaderboard from the players on each live team
+func (t Manager) RefreshLeaderboard() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.refreshLeaderboard()
+}
+
+// must be called with the mutex held
+func (t Manager) refreshLeaderboard() {
+	totals := make(map[int]int)
+
+	for teamId, team := range t.Roster {
+		totals[teamId] = 0
+		for _, member := range team {
+			totals[teamId] += ledger.Total(t.Scope.Keys, member.User.Id)
+		}
+	}
+
+	leaderboard.SetTeams(t.Scope.Keys, totals)
+}
+
+// Take every player back to no points, and empty the leaderboards,
+// ready for a new round
+func (t Manager) ResetPoints() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, team := range t.Roster {
+		for _, member := range team {
+			ledger.Clear(t.Scope.Keys, member.User.Id)
+		}
+	}
+
+	leaderboard.Clear(t.Scope.Keys)
+	t.refreshLeaderboard()
+}
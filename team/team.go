@@ -1,14 +1,16 @@
 package team
 
 import (
-	"bitbucket.org/jahfer/flux-middleman/network"
+	"bitbucket.org/jahfer/flux-middleman/achievements"
 	"bitbucket.org/jahfer/flux-middleman/helper"
+	"bitbucket.org/jahfer/flux-middleman/leaderboard"
 	"bitbucket.org/jahfer/flux-middleman/packet"
 	"bitbucket.org/jahfer/flux-middleman/user"
 	"bitbucket.org/jahfer/flux-middleman/db"
 	"encoding/json"
 	"image/color"
 	"strconv"
+	"sync"
 	"time"
 	"math"
 	"fmt"
@@ -25,18 +27,100 @@ type Manager struct {
 	Queue 		chan Member
 	Unregister 	chan io.Writer
 	LastId	   	chan int
+	Colors		*ColorPool
+	Scope		helper.Scope
+	Contributions	*Contributions
+	Split		SplitStrategy
+	// called as a player leaves, before their keys are removed
+	OnLeave		func(userId int)
+	// called as a team is removed, or merged into another
+	OnTeamGone	func(teamId int)
+	quit		chan bool
+	// held while the Roster changes, or is saved; shared by every copy
+	mutex		*sync.Mutex
 }
 
-func NewManager() Manager {
-	return Manager{
+func NewManager(scope helper.Scope) Manager {
+	t := Manager{
 		Roster: make(map[int] []Member),
 		Queue: make(chan Member),
 		Unregister: make(chan io.Writer),
 		LastId: make(chan int),
+		Colors: NewColorPool(DefaultPalette),
+		Scope: scope,
+		Contributions: NewContributions(),
+		Split: SplitEqual,
+		quit: make(chan bool),
+		mutex: &sync.Mutex{},
 	}
+
+	// badges and points find phones through the roster; the copy
+	// shares the same Roster map
+	t.Scope.Roster = t
+
+	return t
+}
+
+// Connection of the player with the given id
+func (t Manager) Conn(userId int) (io.Writer, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.conn(userId)
+}
+
+// must be called with the mutex held
+func (t Manager) conn(userId int) (io.Writer, bool) {
+	for _, team := range t.Roster {
+		for _, member := range team {
+			if member.User.Id == userId {
+				return member.Conn, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// Finds phones for code already holding the mutex
+type heldRoster struct {
+	t Manager
+}
+
+func (h heldRoster) Conn(userId int) (io.Writer, bool) {
+	return h.t.conn(userId)
 }
 
-func (t Manager) NumUsers() (count int) {
+// Scope to report to while holding the mutex, so badges can still
+// reach the phones
+func (t Manager) heldScope() helper.Scope {
+	s := t.Scope
+	s.Roster = heldRoster{t}
+	return s
+}
+
+// Every team and its members, copied so it can be read while players
+// come and go
+func (t Manager) Members() map[int][]Member {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	teams := make(map[int][]Member, len(t.Roster))
+	for teamId, team := range t.Roster {
+		teams[teamId] = append([]Member(nil), team...)
+	}
+	return teams
+}
+
+func (t Manager) NumUsers() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.numUsers()
+}
+
+// must be called with the mutex held
+func (t Manager) numUsers() (count int) {
 	for _, m := range t.Roster {
 		count += len(m)
 	}
@@ -44,7 +128,15 @@ func (t Manager) NumUsers() (count int) {
 }
 
 func (t Manager) MaxTeams() int {
-	userCount := float64(t.NumUsers())
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.maxTeams()
+}
+
+// must be called with the mutex held
+func (t Manager) maxTeams() int {
+	userCount := float64(t.numUsers())
 	max := math.Ceil( math.Sqrt(userCount) )
 	
 	if (max < 1) { 
@@ -55,6 +147,14 @@ func (t Manager) MaxTeams() int {
 }
 
 func (t Manager) GetIndex(conn io.Writer) (int, int, int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.getIndex(conn)
+}
+
+// must be called with the mutex held
+func (t Manager) getIndex(conn io.Writer) (int, int, int) {
 	for teamId, team := range t.Roster {
 		// for all members
 		for userIndex, member := range team {
@@ -70,6 +170,14 @@ func (t Manager) GetIndex(conn io.Writer) (int, int, int) {
 }
 
 func (t Manager) GetUserIndex(teamId, userId int) int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.getUserIndex(teamId, userId)
+}
+
+// must be called with the mutex held
+func (t Manager) getUserIndex(teamId, userId int) int {
 	for i, member := range t.Roster[teamId] {
 		if member.User.Id == userId {
 			return i
@@ -81,25 +189,38 @@ func (t Manager) GetUserIndex(teamId, userId int) int {
 
 func (t *Manager) ReturnToQueue(teamId int) {
 
+	t.mutex.Lock()
 	members := t.Roster[teamId][0:]
 	t.removeTeam(teamId)
+	t.mutex.Unlock()
 
 	for _, member := range members {
 		t.Queue <- member
 		newTeamId := <-t.LastId
+
+		t.mutex.Lock()
 		t.memberChangeTeam(member.User.Id, newTeamId, newTeamId)
+		t.mutex.Unlock()
 	}
 }
 
 func (t *Manager) removeTeam(teamId int) {
-	teamKey := fmt.Sprintf("team:%v:users", teamId)
-	db.Redis.Del(teamKey)
+	db.Client.Del(t.Scope.Keys.Team(teamId).All()...)
 	delete(t.Roster, teamId)
-	helper.ToXna("collector:destroy", teamId)
+	t.Colors.Release(teamId)
+	leaderboard.RemoveTeam(t.Scope.Keys, teamId)
+	achievements.Default.ForgetTeam(t.Scope, teamId)
+	if t.OnTeamGone != nil {
+		t.OnTeamGone(teamId)
+	}
+	helper.ToXna(t.Scope, "collector:destroy", teamId)
 }
 
 func (t *Manager) removeAnonConnection(conn io.Writer) {
-	teamId, userId, userIndex := t.GetIndex(conn)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	teamId, userId, userIndex := t.getIndex(conn)
 	t.RemoveMember(teamId, userId, userIndex)
 }
 
@@ -110,10 +231,10 @@ func (t Manager) memberChangeTeam(userId, newTeamId, curTeamId int) {
 		TeamId   int    `tcp:"teamId"`
 	}{"user:newTeam", userId, newTeamId}
 
-	network.TcpClients.Broadcast <- msg
+	t.Scope.BroadcastXna(msg)
 
 
-	index := t.GetUserIndex(curTeamId, userId)
+	index := t.getUserIndex(curTeamId, userId)
 
 	toApp := packet.Out{
 		Name:    "user:newTeam",
@@ -128,37 +249,44 @@ func (t *Manager) RemoveMember(teamId, userId, userIndex int) {
 	if teamId != -1 {
 
 		uName := t.Roster[teamId][userIndex].User.Name
+
+		if t.OnLeave != nil {
+			t.OnLeave(userId)
+		}
 		
 		t.Roster[teamId][userIndex] = t.Roster[teamId][len(t.Roster[teamId])-1]
 		t.Roster[teamId] = t.Roster[teamId][0:len(t.Roster[teamId])-1]
 
 		t.removeMemberKeys(userId)
 		t.removeMemberFromTeam(userId, teamId)
+		t.Contributions.Forget(userId)
 
-		userIdKey := fmt.Sprintf("username:%v:uid", uName)
-		db.Redis.Del(userIdKey)
+		if err := user.Release(t.Scope.Keys, uName, userId); err != nil {
+			fmt.Printf("[ERROR]\tCould not release name %q. %v\n", uName, err)
+		}
 
-		helper.ToXna("user:disconnect", userId)
+		helper.ToXna(t.Scope, "user:disconnect", userId)
 	}
 }
 
 func (t Manager) removeMemberKeys(userId int) {
-	// remove user from redis
-	db.Redis.ZRem("global:clients", strconv.Itoa(userId))
+	id := strconv.Itoa(userId)
+
+	// remove user from redis in one round trip
+	err := db.Client.Pipelined(func(b db.Batch) {
+		b.ZRem(t.Scope.Keys.Clients(), id)
+		b.ZRem(t.Scope.Keys.Leaderboard(leaderboard.Users), id)
+		b.Del(t.Scope.Keys.User(userId).All()...)
+	})
 
-	uidPrefix := fmt.Sprintf("uid:%v", userId)
-	db.Redis.Del(uidPrefix + ":points")
-	db.Redis.Del(uidPrefix + ":team")
-	db.Redis.Del(uidPrefix + ":badges")
-	db.Redis.Del(uidPrefix + ":username")
-	db.Redis.Del(uidPrefix + ":shotsFired")
-	db.Redis.Del(uidPrefix + ":harvests")
+	if err != nil {
+		fmt.Printf("[ERROR]\tCould not remove keys for user %v. %v\n", userId, err)
+	}
 }
 
 func (t *Manager) removeMemberFromTeam(userId, teamId int) {
 	// delete user from team
-	teamKey := fmt.Sprintf("team:%v:users", teamId)
-	db.Redis.SRem(teamKey, strconv.Itoa(userId))
+	db.Client.SRem(t.Scope.Keys.Team(teamId).Users(), strconv.Itoa(userId))
 
 	// remove team if empty
 	if len(t.Roster[teamId]) < 1 {
@@ -168,7 +296,7 @@ func (t *Manager) removeMemberFromTeam(userId, teamId int) {
 
 func (t *Manager) addMember(m Member) (teamId int, err error) {
 
-	if len(t.Roster) < t.MaxTeams() {
+	if len(t.Roster) < t.maxTeams() {
 		teamId = t.createNewTeam()
 		t.Roster[teamId] = []Member{ m }
 	} else {
@@ -178,32 +306,29 @@ func (t *Manager) addMember(m Member) (teamId int, err error) {
 		teamId = smallest
 	}
 
-	if len(t.Roster[teamId]) >= 8 {
-		for _, m := range t.Roster[teamId] {
-			helper.SendBadge("theOcho", m.User.Id)
-		}
-	}
+	achievements.Emit(t.heldScope(), t.teamEvent("team:size", teamId))
+	t.Contributions.Join(m.User.Id)
 
 	m.User.TeamId = teamId
 
 	// add user to team list in DB
-	key := fmt.Sprintf("team:%v:users", teamId)
-	db.Redis.SAdd(key, strconv.Itoa(m.User.Id))
-
-	key = fmt.Sprintf("uid:%v:team", m.User.Id)
-	db.Redis.Set(key, strconv.Itoa(teamId))
+	db.Client.SAdd(t.Scope.Keys.Team(teamId).Users(), strconv.Itoa(m.User.Id))
+	db.Client.Set(t.Scope.Keys.User(m.User.Id).Team(), strconv.Itoa(teamId))
 
 	return
 }
 
 func (t *Manager) CheckExpired() {
-	expired := db.Redis.ZRangeByScore("global:clients", "-inf", strconv.FormatInt(time.Now().Unix()-10, 10), 0, -1).Val()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	expired, _ := db.Client.ZRangeByScore(t.Scope.Keys.Clients(), "-inf", strconv.FormatInt(time.Now().Unix()-10, 10))
 	if len(expired) > 0 {
 		for _, idStr := range expired {
-			db.Redis.ZRem("global:clients", idStr)
+			db.Client.ZRem(t.Scope.Keys.Clients(), idStr)
 			id, _ := strconv.Atoi(idStr)
-			teamId, _ := strconv.Atoi(db.Redis.Get("uid:" + idStr + ":team").Val())
-			userIndex := t.GetUserIndex(teamId, id)
+			teamId := db.GetInt(t.Scope.Keys.User(id).Team())
+			userIndex := t.getUserIndex(teamId, id)
 			if userIndex == -1 {
 				fmt.Printf("[ERROR]\tUser's index out of bounds\n")
 				continue
@@ -213,17 +338,19 @@ func (t *Manager) CheckExpired() {
 	}
 }
 
-func (t Manager) Analytics() {
-	for _, team := range t.Roster {
-		for _, member := range team {
-			userShotKey := fmt.Sprintf("uid:%v:shotsFired", member.User.Id)
-			shotsFired, _ := strconv.Atoi(db.Redis.Get(userShotKey).Val())
-			if shotsFired > 2 {
-				helper.SendBadge("triggerHappy", member.User.Id)
-			}
-			db.Redis.Del(userShotKey)
-		}
+// Describe something that happened to a whole team, for badge rules
+func (t Manager) teamEvent(name string, teamId int) achievements.Event {
+	evt := achievements.Event{
+		Name: name,
+		TeamId: teamId,
+		Values: map[string]int{ "size": len(t.Roster[teamId]) },
+	}
+
+	for _, member := range t.Roster[teamId] {
+		evt.Members = append(evt.Members, member.User.Id)
 	}
+
+	return evt
 }
 
 func (t *Manager) getSmallestTeam() int {
@@ -242,22 +369,24 @@ func (t *Manager) getSmallestTeam() int {
 
 func (t *Manager) createNewTeam() int {
 
-	defer db.Redis.Incr("global:nextTeamId")
+	teamId, err := db.NextId(t.Scope.Keys.NextTeamId())
+	if err != nil {
+		fmt.Printf("[ERROR]\tCould not get next team id. %v\n", err)
+	}
 
-	get := db.Redis.Get("global:nextTeamId")
-	teamId, _ := strconv.Atoi(get.Val())
+	t.announceTeam(teamId, t.Colors.Acquire(teamId))
 
-	c := GetNextColor()
+	return teamId
+}
 
+func (t Manager) announceTeam(teamId int, c color.Color) {
 	msg := struct {
 		Name string `tcp:"name"`
 		Id   int    `tcp:"id"`
 		Color color.Color `tcp:"color"`
 	}{"collector:new", teamId, c}
 
-	network.TcpClients.Broadcast <- msg
-
-	return teamId
+	t.Scope.BroadcastXna(msg)
 }
 
 
@@ -268,21 +397,29 @@ type Merger struct {
 }
 
 func (t *Manager) Merge(teams Merger) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
 
-	team1 	:= fmt.Sprintf("team:%v:users", teams.TeamId1)
-	team2 	:= fmt.Sprintf("team:%v:users", teams.TeamId2)
+	team1 	:= t.Scope.Keys.Team(teams.TeamId1).Users()
+	team2 	:= t.Scope.Keys.Team(teams.TeamId2).Users()
 
 	// delete members
-	defer db.Redis.Del(team2)
+	defer db.Client.Del(t.Scope.Keys.Team(teams.TeamId2).All()...)
 	defer delete(t.Roster, teams.TeamId2)
+	defer t.Colors.Release(teams.TeamId2)
+	defer leaderboard.RemoveTeam(t.Scope.Keys, teams.TeamId2)
+	defer achievements.Default.ForgetTeam(t.Scope, teams.TeamId2)
+	if t.OnTeamGone != nil {
+		defer t.OnTeamGone(teams.TeamId2)
+	}
 
-	db.Redis.SUnionStore(team1, team1, team2)
+	db.Client.SUnionStore(team1, team1, team2)
 
-	for _, idStr := range db.Redis.SMembers(team2).Val() {
+	members, _ := db.Client.SMembers(team2)
+	for _, idStr := range members {
 		userId, _ := strconv.Atoi(idStr)
 		// update user id
-		teamKey := fmt.Sprintf("uid:%v:team", userId)
-		db.Redis.Set(teamKey, strconv.Itoa(teams.TeamId1))
+		db.Client.Set(t.Scope.Keys.User(userId).Team(), strconv.Itoa(teams.TeamId1))
 		// tell xna new team id
 		t.memberChangeTeam(userId, teams.TeamId1, teams.TeamId2)
 	}
@@ -292,14 +429,8 @@ func (t *Manager) Merge(teams Merger) {
 	t.Roster[teams.TeamId1] = append(t.Roster[teams.TeamId1], t.Roster[teams.TeamId2]...)
 
 	// everybody, celebrate merge!
-	for _, idStr := range db.Redis.SMembers(team1).Val() {
-		userId, _ := strconv.Atoi(idStr)
-		helper.SendBadge("firstMerge", userId)
-
-		if len(t.Roster[teams.TeamId1]) >= 8 {
-			helper.SendBadge("theOcho", userId)
-		}
-	}
+	achievements.Emit(t.heldScope(), t.teamEvent("collector:merge", teams.TeamId1))
+	achievements.Emit(t.heldScope(), t.teamEvent("team:size", teams.TeamId1))
 }
 
 // Boot cycle for team manager
@@ -308,11 +439,20 @@ func (t *Manager) Run() {
 		select {
 		// add new client
 		case member := <-t.Queue:
+			t.mutex.Lock()
 			teamId, _ := t.addMember(member)
+			t.mutex.Unlock()
 			t.LastId <- teamId
 		// user has disconnected
 		case deadClient := <-t.Unregister:
 			go t.removeAnonConnection(deadClient)
+		case <-t.quit:
+			return
 		}
 	}
+}
+
+// Shut down Run once the room is closed; call it only once
+func (t *Manager) Stop() {
+	close(t.quit)
 }
\ No newline at end of file
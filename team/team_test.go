@@ -0,0 +1,114 @@
+package team
+
+import (
+	"bitbucket.org/jahfer/flux-middleman/db"
+	"bitbucket.org/jahfer/flux-middleman/helper"
+	"bitbucket.org/jahfer/flux-middleman/leaderboard"
+	"bitbucket.org/jahfer/flux-middleman/user"
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMergeTakesTeamOffTheBoard(t *testing.T) {
+	db.Client = db.NewMemory()
+	m := NewManager(helper.NewScope(""))
+	go m.Run()
+	defer m.Stop()
+
+	// the third player is the first to get a second team
+	var teamIds []int
+	for i := 1; i <= 3; i++ {
+		m.Queue <- Member{User: user.User{Id: i}, Conn: &bytes.Buffer{}}
+		teamIds = append(teamIds, <-m.LastId)
+	}
+	teamIds = teamIds[1:]
+	if teamIds[0] == teamIds[1] {
+		t.Fatalf("Every player landed on team %v", teamIds[0])
+	}
+
+	m.RefreshLeaderboard()
+	m.Merge(Merger{TeamId1: teamIds[0], TeamId2: teamIds[1]})
+
+	top := leaderboard.Top(m.Scope.Keys, leaderboard.Teams, 0, 10)
+	if len(top) != 1 || top[0].Id != teamIds[0] {
+		t.Errorf("Board after merging shows %+v", top)
+	}
+}
+
+// Managers sharing a store, as servers sharing Redis do, never hand out
+// the same team id
+func TestConcurrentTeamIds(t *testing.T) {
+	db.Client = db.NewMemory()
+	scope := helper.NewScope("")
+
+	ids := make(chan int, 100)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m := NewManager(scope)
+			for j := 0; j < 25; j++ {
+				ids <- m.createNewTeam()
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[int]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("Team id %v was handed out twice", id)
+		}
+		seen[id] = true
+	}
+	if len(seen) != 100 {
+		t.Errorf("Got %v ids, expected 100", len(seen))
+	}
+}
+
+// Run with -race: the scoreboards used to read the roster while players
+// joined and left
+func TestReadWhilePlayersComeAndGo(t *testing.T) {
+	db.Client = db.NewMemory()
+	m := NewManager(helper.NewScope(""))
+	go m.Run()
+	defer m.Stop()
+
+	done := make(chan bool)
+	go func() {
+		for i := 1; i <= 50; i++ {
+			conn := &bytes.Buffer{}
+			m.Queue <- Member{User: user.User{Id: i}, Conn: conn}
+			<-m.LastId
+			if i%2 == 0 {
+				m.Unregister <- conn
+			}
+		}
+		close(done)
+	}()
+
+	for reading := true; reading; {
+		select {
+		case <-done:
+			reading = false
+		default:
+		}
+		m.Standings()
+		m.Overview()
+		m.RefreshLeaderboard()
+		m.Conn(1)
+		m.Members()
+	}
+
+	// let the last players finish leaving before the store is swapped
+	for deadline := time.Now().Add(time.Second); m.NumUsers() != 25; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Players never finished leaving")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
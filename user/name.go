@@ -0,0 +1,186 @@
+package user
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"golang.org/x/text/unicode/norm"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Returned by Check when the name contains a blocked word
+var ErrNameBlocked = errors.New("That name isn't allowed, please pick another")
+
+// Punctuation allowed in a name besides letters, digits and spaces
+const namePunctuation = "-_.'"
+
+// Digits and look-alike letters read as the letter they stand in for;
+// accents are already stripped by then
+var lookAlikes = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's',
+	'6': 'g', '7': 't', '8': 'b', '9': 'g', 'ø': 'o',
+	// Cyrillic letters drawn the same as Latin ones
+	'а': 'a', 'с': 'c', 'е': 'e', 'і': 'i', 'о': 'o', 'р': 'p', 'х': 'x', 'у': 'y',
+}
+
+// Checks names before they reach the big screen
+type NameFilter struct {
+	MinLength int
+	MaxLength int
+	// blocked words, folded
+	blocked []string
+}
+
+func NewNameFilter(min, max int, blocked []string) *NameFilter {
+	f := &NameFilter{MinLength: min, MaxLength: max}
+	f.SetBlocklist(blocked)
+	return f
+}
+
+// Filter used for every player joining
+var Names = NewNameFilter(1, 16, nil)
+
+// Replace the blocked words. Words match anywhere within a word of the
+// name once both are folded, so keep short entries specific.
+func (f *NameFilter) SetBlocklist(words []string) {
+	f.blocked = f.blocked[:0]
+	for _, word := range words {
+		if folded := strings.Join(foldName(word), ""); folded != "" {
+			f.blocked = append(f.blocked, folded)
+		}
+	}
+}
+
+// Normalize the name and make sure it can be shown; the error is
+// meant for the player
+func (f *NameFilter) Check(name string) (string, error) {
+	name = NormalizeName(name)
+	length := utf8.RuneCountInString(name)
+
+	switch {
+	case length == 0:
+		return "", errors.New("Please pick a name")
+	case length < f.MinLength:
+		return "", fmt.Errorf("Names need at least %d characters", f.MinLength)
+	case f.MaxLength > 0 && length > f.MaxLength:
+		return "", fmt.Errorf("Names can be at most %d characters", f.MaxLength)
+	}
+
+	for _, folded := range foldName(name) {
+		for _, word := range f.blocked {
+			if strings.Contains(folded, word) {
+				return "", ErrNameBlocked
+			}
+		}
+	}
+
+	return name, nil
+}
+
+// Put the name in NFKC form (so fullwidth letters become plain ones),
+// collapse runs of spaces, keep at most one accent on each letter and
+// drop anything else that isn't a letter, digit or namePunctuation
+func NormalizeName(name string) string {
+	var out []rune
+	space, marks := false, 0
+
+	// decomposed first, so every accent can be counted
+	for _, r := range norm.NFKD.String(name) {
+		switch {
+		case unicode.IsSpace(r):
+			space = len(out) > 0
+			continue
+		case unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r):
+			if len(out) > 0 && !space && marks == 0 {
+				out = append(out, r)
+				marks++
+			}
+			continue
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(namePunctuation, r):
+			continue
+		}
+
+		if space {
+			out = append(out, ' ')
+			space = false
+		}
+		out = append(out, r)
+		marks = 0
+	}
+
+	return norm.NFKC.String(string(out))
+}
+
+// Reduce each word of a name to the letters it reads as. Within a word
+// separators are ignored, so "5H-1-TT" and "shit" come out the same,
+// but words are kept apart unless they are single letters, as in
+// "S H I T"; otherwise "Ash Itoh" would read as a blocked word.
+func foldName(name string) (words []string) {
+	// the last word was made of single letters
+	spelled := false
+
+	for _, token := range strings.Fields(NormalizeName(name)) {
+		word := foldWord(token)
+
+		switch {
+		case word == "":
+			continue
+		case utf8.RuneCountInString(word) > 1:
+			words = append(words, word)
+			spelled = false
+		case spelled:
+			words[len(words)-1] += word
+		default:
+			words = append(words, word)
+			spelled = true
+		}
+	}
+
+	return
+}
+
+// Lower case, accents stripped, look-alikes swapped for plain letters,
+// everything else dropped and repeated letters squeezed
+func foldWord(word string) string {
+	var out []rune
+
+	for _, r := range strings.ToLower(norm.NFKD.String(word)) {
+		if plain, ok := lookAlikes[r]; ok {
+			r = plain
+		}
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if len(out) > 0 && out[len(out)-1] == r {
+			continue
+		}
+		out = append(out, r)
+	}
+
+	return string(out)
+}
+
+// Read blocked words from a file, one per line; blank lines and lines
+// starting with # are skipped
+func LoadBlocklist(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+
+	return words, scanner.Err()
+}
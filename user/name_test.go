@@ -0,0 +1,64 @@
+package user
+
+import (
+	"testing"
+)
+
+func TestNormalizeName(t *testing.T) {
+	cases := map[string]string{
+		"  Joe   Bloggs ":       "Joe Bloggs",
+		"ＪＯＥ":                   "JOE",
+		"Jo\u200be":             "Joe",
+		"Zoë":                   "Zoë",
+		"Z\u0301\u0302\u0303oe": "\u0179oe",
+		"ﬁsh":                   "fish",
+		"<b>Joe</b>!":           "bJoeb",
+	}
+
+	for in, want := range cases {
+		if got := NormalizeName(in); got != want {
+			t.Errorf("NormalizeName(%q) = %q, expected %q", in, got, want)
+		}
+	}
+}
+
+func TestNameLength(t *testing.T) {
+	f := NewNameFilter(2, 5, nil)
+
+	for _, name := range []string{"", " \t", "J", "Joseph"} {
+		if _, err := f.Check(name); err == nil {
+			t.Errorf("%q was let through", name)
+		}
+	}
+
+	// counted in characters, not bytes
+	if name, err := f.Check("Zoë Ö"); err != nil || name != "Zoë Ö" {
+		t.Errorf("Got %q and %v", name, err)
+	}
+}
+
+func TestBlocklistSeesThroughDisguises(t *testing.T) {
+	f := NewNameFilter(1, 16, []string{"shit"})
+
+	for _, name := range []string{"shit", "SH1T", "5h-i-t", "Shiiiit", "ｓｈｉｔ", "bullshitter", "shít", "S.H.I.T", "S H I T"} {
+		if _, err := f.Check(name); err != ErrNameBlocked {
+			t.Errorf("%q got past the blocklist (%v)", name, err)
+		}
+	}
+
+	for _, name := range []string{"Joe", "Shirt", "Sh1re"} {
+		if _, err := f.Check(name); err != nil {
+			t.Errorf("%q was blocked. %v", name, err)
+		}
+	}
+}
+
+func TestBlocklistKeepsWordsApart(t *testing.T) {
+	f := NewNameFilter(1, 16, []string{"shit", "penis"})
+
+	for _, name := range []string{"Ash Itoh", "Pen Is", "Pen Island", "Mash It", "A Shirt"} {
+		if _, err := f.Check(name); err != nil {
+			t.Errorf("%q was blocked. %v", name, err)
+		}
+	}
+}
@@ -2,10 +2,32 @@ package user
 
 import (
 	"bitbucket.org/jahfer/flux-middleman/db"
+	"bitbucket.org/jahfer/flux-middleman/keys"
+	"errors"
 	"strconv"
-	"fmt"
 )
 
+// What happens when a player picks a name somebody in the room has
+const (
+	// turn the player away
+	Reject = "reject"
+	// hand them the name with the lowest free number on the end, e.g. JOE2
+	Suffix = "suffix"
+)
+
+var OnCollision = Suffix
+
+func IsCollisionMode(mode string) bool {
+	return mode == Reject || mode == Suffix
+}
+
+// Returned by Save when the name (and every numbered variant tried)
+// is in use
+var ErrNameTaken = errors.New("Name already taken")
+
+// highest number put on the end of a name before giving up
+const maxSuffix = 99
+
 type Id struct {
 	Id int `json:"id"`
 	TeamId int `json:"team_id"`
@@ -17,36 +39,104 @@ type User struct {
 	TeamId  int 	`json:"team_id"`
 	Points  int 	`json:"points"`
 	Display int 	`json:"display"`
+	Room 	string 	`json:"room"`
+	// device or account id the lifetime profile is kept under
+	Device 	string 	`json:"device"`
+	// screen size the phone reports on join
+	Viewport Viewport `json:"viewport"`
 }
 
-func (u *User) Save() (error, error) {
+type Viewport struct {
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// Store the user in the room's key space. The name may come back with
+// a number on the end if someone else already has it. The name is
+// claimed before an id is taken, so turned away players don't use up
+// ids.
+func (u *User) Save(k keys.Room) (error, error) {
+	name, err := reserve(k, u.Name)
+	if err != nil {
+		return err, nil
+	}
+
 	// set ID for user
-	u.Id = getNextId()
+	id, err := db.NextId(k.NextUserId())
+	if err != nil {
+		db.Client.Del(k.Username(name))
+		return nil, err
+	}
+
+	// the name was held for nobody until now
+	if err := db.Client.Set(k.Username(name), strconv.Itoa(id)); err != nil {
+		db.Client.Del(k.Username(name))
+		return nil, err
+	}
+	u.Id = id
+	u.Name = name
+
 	// store user in DB
-	key := fmt.Sprintf("username:%v:uid", u.Name)
-	setId := db.Redis.Set(key, strconv.Itoa(u.Id))
-	usernameKey := fmt.Sprintf("uid:%v:username", u.Id)
-	setName := db.Redis.Set(usernameKey, u.Name)
-	
-	return setId.Err(), setName.Err()
+	setName := db.Client.Set(k.User(u.Id).Username(), u.Name)
+
+	return nil, setName
 }
 
-type Coords struct {
-	Id int `json:"id"`
-	X  int `json:"x"`
-	Y  int `json:"y"`
+// Hold the name, or the first free numbered variant of it, for a
+// player yet to get an id
+func reserve(k keys.Room, name string) (string, error) {
+	for n := 1; n <= maxSuffix; n++ {
+		candidate := name
+		if n > 1 {
+			suffix := strconv.Itoa(n)
+			candidate = trimName(name, Names.MaxLength-len(suffix)) + suffix
+		}
+
+		ok, err := db.Client.SetNX(k.Username(candidate), "")
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return candidate, nil
+		}
+
+		if OnCollision == Reject {
+			break
+		}
+	}
+
+	return "", ErrNameTaken
 }
 
-func getNextId() (id int) {
-	get := db.Redis.Get("global:nextUserId")
-	if err := get.Err(); err != nil {
-		panic("Could not get next user id " + err.Error())
+// Cut the name down to at most max characters; max of 0 or less
+// leaves it alone
+func trimName(name string, max int) string {
+	runes := []rune(name)
+	if max <= 0 || len(runes) <= max {
+		return name
 	}
+	return string(runes[:max])
+}
 
-	defer db.Redis.Incr("global:nextUserId")
+// Give the name up, provided the player still holds it. Nobody else
+// can claim the name until it is deleted, so checking first is safe.
+func Release(k keys.Room, name string, id int) error {
+	owner, err := db.Client.Get(k.Username(name))
+	if err == db.Nil {
+		return nil
+	} else if err != nil {
+		return err
+	}
 
-	val, _ := strconv.ParseInt(get.Val(), 10, 0)
-	id = int(val)
+	if owner != strconv.Itoa(id) {
+		return nil
+	}
 
-	return
-}
\ No newline at end of file
+	return db.Client.Del(k.Username(name))
+}
+
+type Coords struct {
+	Id int     `json:"id"`
+	X  float64 `json:"x"`
+	Y  float64 `json:"y"`
+}
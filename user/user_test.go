@@ -0,0 +1,122 @@
+package user
+
+import (
+	"bitbucket.org/jahfer/flux-middleman/db"
+	"bitbucket.org/jahfer/flux-middleman/keys"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentJoinsGetUniqueIds(t *testing.T) {
+	db.Client = db.NewMemory()
+	k := keys.ForRoom("")
+	db.Client.Set(k.NextUserId(), "0")
+
+	const joins = 200
+
+	ids := make(chan int, joins)
+	var wg sync.WaitGroup
+
+	for i := 0; i < joins; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			u := User{Name: "player" + strconv.Itoa(i)}
+			u.Save(k)
+			ids <- u.Id
+		}(i)
+	}
+
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[int]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("Id %v handed out twice", id)
+		}
+		seen[id] = true
+	}
+
+	if len(seen) != joins {
+		t.Errorf("Got %v ids for %v joins", len(seen), joins)
+	}
+	if next := db.GetInt(k.NextUserId()); next != joins {
+		t.Errorf("Next id is %v, expected %v", next, joins)
+	}
+}
+
+func TestNameCollisions(t *testing.T) {
+	db.Client = db.NewMemory()
+	defer func() { OnCollision = Suffix }()
+	k := keys.ForRoom("")
+	db.Client.Set(k.NextUserId(), "0")
+
+	first := User{Name: "Joe"}
+	first.Save(k)
+
+	OnCollision = Suffix
+	second := User{Name: "JOE"}
+	if err, _ := second.Save(k); err != nil || second.Name != "JOE2" {
+		t.Errorf("Got name %q and error %v, expected JOE2", second.Name, err)
+	}
+
+	OnCollision = Reject
+	third := User{Name: "joe"}
+	if err, _ := third.Save(k); err != ErrNameTaken {
+		t.Errorf("Expected ErrNameTaken, got %v", err)
+	}
+
+	// only the owner can give the name up
+	Release(k, "Joe", second.Id)
+	if owner, _ := db.Client.Get(k.Username("Joe")); owner != strconv.Itoa(first.Id) {
+		t.Errorf("Name was released by someone who didn't hold it")
+	}
+
+	Release(k, "Joe", first.Id)
+	if _, err := db.Client.Get(k.Username("Joe")); err != db.Nil {
+		t.Errorf("Name still reserved after its owner released it")
+	}
+}
+
+func TestSuffixFitsMaxLength(t *testing.T) {
+	db.Client = db.NewMemory()
+	k := keys.ForRoom("")
+	db.Client.Set(k.NextUserId(), "0")
+
+	long := "Bartholomew Jone"
+	first := User{Name: long}
+	first.Save(k)
+
+	second := User{Name: long}
+	if err, _ := second.Save(k); err != nil || second.Name != "Bartholomew Jon2" {
+		t.Errorf("Got name %q and error %v, expected Bartholomew Jon2", second.Name, err)
+	}
+}
+
+func TestTakenNamesDontUseUpIds(t *testing.T) {
+	db.Client = db.NewMemory()
+	defer func() { OnCollision = Suffix }()
+	k := keys.ForRoom("")
+	db.Client.Set(k.NextUserId(), "0")
+
+	OnCollision = Reject
+	first := User{Name: "Joe"}
+	first.Save(k)
+
+	for i := 0; i < 3; i++ {
+		again := User{Name: "Joe"}
+		if err, _ := again.Save(k); err != ErrNameTaken {
+			t.Errorf("Expected ErrNameTaken, got %v", err)
+		}
+	}
+
+	second := User{Name: "Ann"}
+	if err, _ := second.Save(k); err != nil || second.Id != first.Id+1 {
+		t.Errorf("Got id %v and error %v, expected %v", second.Id, err, first.Id+1)
+	}
+	if owner, _ := db.Client.Get(k.Username("Ann")); owner != strconv.Itoa(second.Id) {
+		t.Errorf("Name is held for %q, expected %v", owner, second.Id)
+	}
+}